@@ -0,0 +1,160 @@
+// Package audit keeps a JSON-lines log of remote invocations, rotated by
+// size.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yhiraki/remote/internal/lock"
+)
+
+// Record is one invocation of remote.
+type Record struct {
+	// ID numbers the records of a log in sequence, unchanged by rotation.
+	ID      int64     `json:"id,omitempty"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Host    string    `json:"host,omitempty"`
+	Profile string    `json:"profile,omitempty"`
+	// Dir is the local working directory.
+	Dir     string `json:"dir"`
+	Command string `json:"command"`
+	// Args are the arguments following the program name, with the values
+	// of secrets redacted.
+	Args          []string `json:"args"`
+	ExitCode      int      `json:"exitCode"`
+	Error         string   `json:"error,omitempty"`
+	DurationMs    int64    `json:"durationMs"`
+	BytesSent     int64    `json:"bytesSent,omitempty"`
+	BytesReceived int64    `json:"bytesReceived,omitempty"`
+}
+
+// Log is a log file rotated once it exceeds MaxBytes, keeping MaxFiles
+// rotated files named File.1 (the newest) to File.<MaxFiles>.
+type Log struct {
+	File     string
+	MaxBytes int64
+	MaxFiles int
+}
+
+// Append writes rec at the end of the log, numbered after the last record,
+// rotating the log first if needed.
+func (l *Log) Append(rec *Record) error {
+	if err := os.MkdirAll(filepath.Dir(l.File), 0o705); err != nil {
+		return err
+	}
+	lk, err := lock.Acquire(context.Background(), l.File+".lock", nil)
+	if err != nil {
+		return err
+	}
+	defer lk.Unlock()
+
+	last, err := l.lastID()
+	if err != nil {
+		return err
+	}
+	rec.ID = last + 1
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if st, err := os.Stat(l.File); err == nil && st.Size() > 0 && st.Size()+int64(len(line)) > l.MaxBytes {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(l.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// lastID returns the ID of the newest record, 0 if there is none.
+func (l *Log) lastID() (int64, error) {
+	for _, name := range []string{l.File, l.rotated(1)} {
+		recs, err := readFile(name)
+		if err != nil {
+			return 0, err
+		}
+		if len(recs) > 0 {
+			return recs[len(recs)-1].ID, nil
+		}
+	}
+	return 0, nil
+}
+
+// rotate renames File to File.1, shifting the older files and removing the
+// oldest one.
+func (l *Log) rotate() error {
+	if l.MaxFiles < 1 {
+		return os.Remove(l.File)
+	}
+	if err := os.Remove(l.rotated(l.MaxFiles)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for i := l.MaxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(l.rotated(i), l.rotated(i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(l.File, l.rotated(1))
+}
+
+func (l *Log) rotated(i int) string {
+	return fmt.Sprintf("%s.%d", l.File, i)
+}
+
+// Read returns the records of the log and its rotated files, oldest first.
+// Lines that are not valid records are skipped.
+func (l *Log) Read() ([]Record, error) {
+	var records []Record
+	for i := l.MaxFiles; i >= 0; i-- {
+		name := l.File
+		if i > 0 {
+			name = l.rotated(i)
+		}
+		recs, err := readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, recs...)
+	}
+	return records, nil
+}
+
+func readFile(name string) ([]Record, error) {
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var rec Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records, sc.Err()
+}
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	l := &Log{File: filepath.Join(t.TempDir(), "logs", "audit.log"), MaxBytes: 1 << 20, MaxFiles: 2}
+	want := []Record{
+		{Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), User: "alice", Host: "example.com", Command: "push", Args: []string{"push", "src"}, BytesSent: 42},
+		{Time: time.Date(2026, 1, 2, 3, 5, 0, 0, time.UTC), User: "alice", Command: "sh", Args: []string{"sh", "false"}, ExitCode: 1, Error: "exit status 1"},
+	}
+	for i := range want {
+		if err := l.Append(&want[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a line left by a crash is skipped
+	f, err := os.OpenFile(l.File, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2026-01-02T03:0` + "\n")
+	f.Close()
+
+	got, err := l.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read() = %+v, want %+v", got, want)
+	}
+	if want[0].ID != 1 || want[1].ID != 2 {
+		t.Errorf("IDs = %d, %d, want 1, 2", want[0].ID, want[1].ID)
+	}
+	if st, err := os.Stat(l.File); err != nil || st.Mode().Perm() != 0o600 {
+		t.Errorf("log file mode = %v, %v, want 0600", st, err)
+	}
+}
+
+func TestLog_rotate(t *testing.T) {
+	l := &Log{File: filepath.Join(t.TempDir(), "audit.log"), MaxBytes: 300, MaxFiles: 2}
+	for i := 0; i < 20; i++ {
+		if err := l.Append(&Record{Command: "sh", Args: []string{strconv.Itoa(i)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{l.File, l.File + ".1", l.File + ".2"} {
+		st, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Size() > l.MaxBytes {
+			t.Errorf("%s has %d bytes, want at most %d", name, st.Size(), l.MaxBytes)
+		}
+	}
+	if _, err := os.Stat(l.File + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more than MaxFiles rotated files are kept: %v", err)
+	}
+
+	records, err := l.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 || len(records) == 20 {
+		t.Fatalf("Read() returned %d records, want the retained ones", len(records))
+	}
+	// the retained records are the newest ones, in order
+	first, _ := strconv.Atoi(records[0].Args[0])
+	for i, rec := range records {
+		if rec.Args[0] != strconv.Itoa(first+i) {
+			t.Errorf("record %d = %v, want %d", i, rec.Args, first+i)
+		}
+		// IDs keep numbering all the records, dropped ones included
+		if rec.ID != int64(first+i+1) {
+			t.Errorf("record %d has ID %d, want %d", i, rec.ID, first+i+1)
+		}
+	}
+	if last := records[len(records)-1].Args[0]; last != "19" {
+		t.Errorf("last record = %s, want 19", last)
+	}
+}
@@ -0,0 +1,266 @@
+// Package bisync reconciles a local and a remote directory against the file
+// hashes recorded at their last synchronization.
+package bisync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yhiraki/remote/internal/atomicfile"
+)
+
+// Hashes maps slash-separated paths relative to the synchronized directory
+// to the hex encoded SHA-256 of their content.
+type Hashes map[string]string
+
+// State is what is remembered of the last synchronization.
+type State struct {
+	Files Hashes `json:"files"`
+}
+
+// Load reads the state saved in file. A missing file is an empty state.
+func Load(file string) (*State, error) {
+	content, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &State{Files: Hashes{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &State{}
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, err
+	}
+	if s.Files == nil {
+		s.Files = Hashes{}
+	}
+	return s, nil
+}
+
+// Save writes the state to file, creating its directory.
+func (s *State) Save(file string) error {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o705); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(file, content, 0o644)
+}
+
+// Status is how one side changed a file since the last synchronization.
+type Status int
+
+const (
+	Absent Status = iota
+	Unchanged
+	Added
+	Modified
+	Deleted
+)
+
+func (s Status) String() string {
+	switch s {
+	case Unchanged:
+		return "unchanged"
+	case Added:
+		return "added"
+	case Modified:
+		return "modified"
+	case Deleted:
+		return "deleted"
+	default:
+		return "absent"
+	}
+}
+
+func (s Status) changed() bool {
+	return s == Added || s == Modified || s == Deleted
+}
+
+// Action is what synchronizing does with a file.
+type Action int
+
+const (
+	Push Action = iota + 1
+	Pull
+	DeleteLocal
+	DeleteRemote
+	Conflict
+)
+
+func (a Action) String() string {
+	switch a {
+	case Push:
+		return "push"
+	case Pull:
+		return "pull"
+	case DeleteLocal:
+		return "delete local"
+	case DeleteRemote:
+		return "delete remote"
+	default:
+		return "conflict"
+	}
+}
+
+// Change is a file differing between the two sides.
+type Change struct {
+	Path   string
+	Action Action
+	Local  Status
+	Remote Status
+}
+
+// Reconcile compares the local and remote hashes with those of the last
+// synchronization. A file changed on one side only is copied, or deleted, to
+// the other side; a file changed differently on both sides is a Conflict.
+// Changes are sorted by path.
+func Reconcile(base, local, remote Hashes) []Change {
+	paths := map[string]bool{}
+	for _, h := range []Hashes{base, local, remote} {
+		for p := range h {
+			paths[p] = true
+		}
+	}
+
+	var changes []Change
+	for p := range paths {
+		l, lok := local[p]
+		r, rok := remote[p]
+		if lok == rok && l == r {
+			continue
+		}
+		ch := Change{Path: p, Local: status(base, p, l, lok), Remote: status(base, p, r, rok)}
+		switch {
+		case ch.Local.changed() && ch.Remote.changed():
+			ch.Action = Conflict
+		case ch.Local.changed():
+			ch.Action = Push
+			if !lok {
+				ch.Action = DeleteRemote
+			}
+		default:
+			ch.Action = Pull
+			if !rok {
+				ch.Action = DeleteLocal
+			}
+		}
+		changes = append(changes, ch)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func status(base Hashes, name, hash string, ok bool) Status {
+	b, bok := base[name]
+	switch {
+	case !bok && !ok:
+		return Absent
+	case !bok:
+		return Added
+	case !ok:
+		return Deleted
+	case b == hash:
+		return Unchanged
+	default:
+		return Modified
+	}
+}
+
+// HashDir returns the hashes of the regular files under root, skipping the
+// paths excluded by any of the exclude patterns.
+func HashDir(root string, exclude []string) (Hashes, error) {
+	hashes := Hashes{}
+	err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && Excluded(rel, exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		sum, err := hashFile(file)
+		if err != nil {
+			return err
+		}
+		hashes[rel] = sum
+		return nil
+	})
+	return hashes, err
+}
+
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ParseHashes parses the output of sha256sum run on paths starting with "./",
+// skipping the paths excluded by any of the exclude patterns.
+func ParseHashes(out string, exclude []string) Hashes {
+	hashes := Hashes{}
+	for _, line := range strings.Split(out, "\n") {
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok || len(sum) != sha256.Size*2 {
+			continue
+		}
+		name = strings.TrimPrefix(name, "./")
+		if !Excluded(name, exclude) {
+			hashes[name] = sum
+		}
+	}
+	return hashes
+}
+
+// Excluded reports whether name, or one of its parent directories, matches
+// one of the patterns. Like rsync, patterns without a slash match the base
+// name of each path element and the others the whole path.
+func Excluded(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(pattern, "/")
+		anchored := strings.HasPrefix(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		if !anchored && !strings.Contains(pattern, "/") {
+			for _, elem := range strings.Split(name, "/") {
+				if ok, _ := path.Match(pattern, elem); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for p := name; p != "."; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package bisync
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	base := Hashes{"same": "1", "pushed": "1", "pulled": "1", "both": "1", "gone-local": "1", "gone-remote": "1", "edited-gone": "1", "both-gone": "1", "converged": "1"}
+	local := Hashes{"same": "1", "pushed": "2", "pulled": "1", "both": "2", "gone-remote": "1", "edited-gone": "2", "new-local": "1", "new-both": "1", "converged": "2"}
+	remote := Hashes{"same": "1", "pushed": "1", "pulled": "2", "both": "3", "gone-local": "1", "new-remote": "1", "new-both": "2", "converged": "2"}
+
+	want := []Change{
+		{Path: "both", Action: Conflict, Local: Modified, Remote: Modified},
+		{Path: "edited-gone", Action: Conflict, Local: Modified, Remote: Deleted},
+		{Path: "gone-local", Action: DeleteRemote, Local: Deleted, Remote: Unchanged},
+		{Path: "gone-remote", Action: DeleteLocal, Local: Unchanged, Remote: Deleted},
+		{Path: "new-both", Action: Conflict, Local: Added, Remote: Added},
+		{Path: "new-local", Action: Push, Local: Added, Remote: Absent},
+		{Path: "new-remote", Action: Pull, Local: Absent, Remote: Added},
+		{Path: "pulled", Action: Pull, Local: Unchanged, Remote: Modified},
+		{Path: "pushed", Action: Push, Local: Modified, Remote: Unchanged},
+	}
+	if got := Reconcile(base, local, remote); !reflect.DeepEqual(got, want) {
+		t.Errorf("Reconcile() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     bool
+	}{
+		{name: "a/node_modules/b.js", patterns: []string{"node_modules"}, want: true},
+		{name: "a/app.log", patterns: []string{"*.log"}, want: true},
+		{name: "build/out", patterns: []string{"/build/"}, want: true},
+		{name: "src/build/out", patterns: []string{"/build"}, want: false},
+		{name: "src/gen/a.go", patterns: []string{"src/gen"}, want: true},
+		{name: "main.go", patterns: []string{".git", "*.log"}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := Excluded(tt.name, tt.patterns); got != tt.want {
+			t.Errorf("Excluded(%q, %q) = %v, want %v", tt.name, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestHashDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b", ".git/HEAD": "ref"} {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := HashDir(dir, []string{".git"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Hashes{
+		"a.txt":     "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb",
+		"sub/b.txt": "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("HashDir() = %v, want %v", got, want)
+	}
+
+	// sha256sum output for the same files, as listed on the remote host
+	out := "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb  ./a.txt\n" +
+		"3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d  ./sub/b.txt\n" +
+		strings.Repeat("0", 64) + "  ./.git/HEAD\n"
+	if got := ParseHashes(out, []string{".git"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseHashes() = %v, want %v", got, want)
+	}
+}
+
+func TestState(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sync", "state.json")
+	s, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Files) != 0 {
+		t.Errorf("Load() of a missing file = %v, want empty", s.Files)
+	}
+
+	s.Files["a.txt"] = "1"
+	if err := s.Save(file); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, s) {
+		t.Errorf("Load() = %+v, want %+v", loaded, s)
+	}
+}
@@ -0,0 +1,99 @@
+package command
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/yhiraki/remote/internal/audit"
+	"github.com/yhiraki/remote/internal/config"
+)
+
+// secretHolder is implemented by the commands whose flags hold secrets, to
+// redact them from the audit log.
+type secretHolder interface {
+	// secrets returns the KEY=VALUE flag values to redact.
+	secrets() []string
+}
+
+// auditLog returns the audit log configured in cfg.
+func auditLog(cfg *config.Config) *audit.Log {
+	return &audit.Log{
+		File:     cfg.AuditLogFile(),
+		MaxBytes: int64(cfg.AuditLog.MaxSizeKB) * 1024,
+		MaxFiles: cfg.AuditLog.MaxFiles,
+	}
+}
+
+// audit appends the record of the invocation run since start to the audit
+// log. Failing to write it is only reported.
+func (inv *Invocation) audit(ctx *Context, start time.Time, err error) {
+	cfg := ctx.Config
+	if cfg == nil || cfg.AuditLog.Disabled || inv.Spec.NoAudit || ctx.DryRun != DryRunOff {
+		return
+	}
+	var secrets []string
+	if h, ok := inv.Command.(secretHolder); ok {
+		secrets = h.secrets()
+	}
+	dir, _ := os.Getwd()
+	rec := &audit.Record{
+		Time:          start,
+		User:          currentUser(),
+		Host:          ctx.plan.Host,
+		Profile:       cfg.Profile,
+		Dir:           dir,
+		Command:       inv.Spec.Name,
+		Args:          redactArgs(inv.Argv, secrets),
+		ExitCode:      exitCode(err),
+		DurationMs:    time.Since(start).Milliseconds(),
+		BytesSent:     ctx.transferred.BytesSent,
+		BytesReceived: ctx.transferred.BytesReceived,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if err := auditLog(cfg).Append(rec); err != nil {
+		slog.Warn("could not write the audit log", "file", cfg.AuditLogFile(), "err", err)
+	}
+}
+
+// redactArgs returns args with the values of secrets, given as KEY=VALUE,
+// replaced by secretMask.
+func redactArgs(args, secrets []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = arg
+		for _, s := range secrets {
+			key, _, _ := strings.Cut(s, "=")
+			if arg == s || strings.HasPrefix(arg, "-") && strings.HasSuffix(arg, "="+s) {
+				redacted[i] = strings.TrimSuffix(arg, s) + key + "=" + secretMask
+				break
+			}
+		}
+	}
+	return redacted
+}
+
+// exitCode returns the exit status of remote for err.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr) && exitErr.ExitCode() > 0:
+		return exitErr.ExitCode()
+	}
+	return 1
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
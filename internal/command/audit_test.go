@@ -0,0 +1,65 @@
+package command
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func TestRedactArgs(t *testing.T) {
+	args := []string{"sh", "-e", "TOKEN=s3cret", "--env=KEY=v=1", "-e", "FORWARDED", "env", "DEBUG=1"}
+	secrets := []string{"TOKEN=s3cret", "KEY=v=1"}
+	want := []string{"sh", "-e", "TOKEN=***", "--env=KEY=***", "-e", "FORWARDED", "env", "DEBUG=1"}
+	if got := redactArgs(args, secrets); !reflect.DeepEqual(got, want) {
+		t.Errorf("redactArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestInvocation_audit(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte("#!/bin/sh\nexit 3\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.CacheDir = t.TempDir()
+	cfg.AuditLog.File = filepath.Join(cfg.CacheDir, "audit.log")
+	cfg.Profile = "gpu"
+	for _, args := range [][]string{
+		{"sh", "-e", "TOKEN=s3cret", "make"},
+		{"history", "no match"},
+	} {
+		inv, err := Parse(args, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inv.Run(context.Background(), cfg, func() (string, error) { return "10.0.0.1", nil }, ".")
+	}
+
+	records, err := auditLog(cfg).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("audit log has %d records, want 1: %+v", len(records), records)
+	}
+	rec := records[0]
+	wd, _ := os.Getwd()
+	if rec.Command != "sh" || rec.Host != "10.0.0.1" || rec.Profile != "gpu" || rec.Dir != wd || rec.User == "" {
+		t.Errorf("record = %+v", rec)
+	}
+	if want := []string{"sh", "-e", "TOKEN=***", "make"}; !reflect.DeepEqual(rec.Args, want) {
+		t.Errorf("record args = %q, want %q", rec.Args, want)
+	}
+	if rec.ExitCode != 3 || rec.Error == "" {
+		t.Errorf("record exit code = %d, error = %q, want 3", rec.ExitCode, rec.Error)
+	}
+}
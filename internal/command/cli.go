@@ -0,0 +1,293 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yhiraki/remote/internal/config"
+	"github.com/yhiraki/remote/internal/logging"
+)
+
+const defaultCommand = "sh"
+
+// usageOutput receives the usage printed when help is requested with -h.
+var usageOutput io.Writer = os.Stderr
+
+// Options holds the flags accepted by every subcommand.
+type Options struct {
+	DryRun      DryRunMode
+	IsVerbose   bool
+	ShowVersion bool
+	Host        string
+	LogLevel    string
+	LogFormat   string
+	LogFile     string
+	Trace       bool
+	TraceFile   string
+}
+
+// SetFlags registers the global flags. The current values are kept as defaults
+// so that flags given before the subcommand name survive a second registration.
+func (o *Options) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Host, "host", o.Host, "use the named host profile from the config file")
+	fs.Var(&o.DryRun, "dry-run", "print commands instead of running them (--dry-run=text|json|sh)")
+	fs.BoolVar(&o.IsVerbose, "verbose", o.IsVerbose, "enable verbose output and debug logging")
+	fs.StringVar(&o.LogLevel, "log-level", o.LogLevel, "log messages of this level and above: debug, info, warn or error (default warn)")
+	fs.StringVar(&o.LogFormat, "log-format", o.LogFormat, "log format: text or json (default text)")
+	fs.StringVar(&o.LogFile, "log-file", o.LogFile, "append the logs to this file instead of stderr")
+	fs.BoolVar(&o.Trace, "trace", o.Trace, "print the time spent in each phase, such as host resolution and transfers, to stderr")
+	fs.StringVar(&o.TraceFile, "trace-file", o.TraceFile, "trace as --trace and write the spans to this file as Chrome trace events")
+	fs.BoolVar(&o.ShowVersion, "version", o.ShowVersion, "print version information")
+}
+
+// LogOptions returns the logging options given by the flags over those of
+// env, the value of logging.EnvVar. --verbose logs debug messages unless a
+// level is given.
+func (o *Options) LogOptions(env string) (logging.Options, error) {
+	lo := logging.DefaultOptions
+	if err := logging.ParseEnv(env, &lo); err != nil {
+		return lo, err
+	}
+	var err error
+	switch {
+	case o.LogLevel != "":
+		if lo.Level, err = logging.ParseLevel(o.LogLevel); err != nil {
+			return lo, err
+		}
+	case o.IsVerbose:
+		lo.Level = slog.LevelDebug
+	}
+	if o.LogFormat != "" {
+		if lo.Format, err = logging.ParseFormat(o.LogFormat); err != nil {
+			return lo, err
+		}
+	}
+	if o.LogFile != "" {
+		lo.File = o.LogFile
+	}
+	return lo, nil
+}
+
+// Tracing reports whether the phases of the invocation are timed.
+func (o *Options) Tracing() bool {
+	return o.Trace || o.TraceFile != ""
+}
+
+// Invocation is a parsed command line.
+type Invocation struct {
+	Spec        *Spec
+	Command     Command
+	Args        []string
+	Passthrough []string
+	Options     Options
+	// Argv are the arguments Parse was given.
+	Argv []string
+}
+
+// Parse parses the command line arguments following the program name.
+// Global flags may appear before or after the subcommand name.
+// Names of aliases and tasks are looked up in cfg, which may be nil.
+// When help was requested, the usage is printed and flag.ErrHelp is returned.
+func Parse(args []string, cfg *config.Config) (*Invocation, error) {
+	inv := &Invocation{Argv: args}
+
+	global := flag.NewFlagSet("remote", flag.ContinueOnError)
+	global.SetOutput(io.Discard)
+	inv.Options.SetFlags(global)
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage(usageOutput)
+		}
+		return nil, err
+	}
+	args = global.Args()
+
+	name := defaultCommand
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	spec, ok := Lookup(name, cfg)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a valid command. See 'remote help'.", name)
+	}
+	inv.Spec = spec
+	inv.Command = spec.New()
+
+	fs := inv.flagSet()
+	fs.SetOutput(io.Discard)
+	var err error
+	switch {
+	case spec.RawArgs:
+		inv.Args, err = extractFlags(fs, args)
+	case spec.Interspersed:
+		var after []string
+		inv.Args, after, err = parseInterspersed(fs, args)
+		if spec.Passthrough {
+			inv.Passthrough = after
+		} else {
+			inv.Args = append(inv.Args, after...)
+		}
+	default:
+		err = fs.Parse(args)
+		inv.Args = fs.Args()
+	}
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printCommandUsage(usageOutput, spec)
+			return nil, err
+		}
+		return nil, fmt.Errorf("remote %s: %w", spec.Name, err)
+	}
+	return inv, nil
+}
+
+// flagSet returns a flag set holding both the global and the command flags.
+func (inv *Invocation) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("remote "+inv.Spec.Name, flag.ContinueOnError)
+	inv.Options.SetFlags(fs)
+	inv.Command.SetFlags(fs)
+	return fs
+}
+
+// parseInterspersed parses flags wherever they appear in args and returns the
+// remaining positional arguments, and apart those following "--".
+func parseInterspersed(fs *flag.FlagSet, args []string) (positional, after []string, err error) {
+	positional = []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return positional, rest, nil
+		}
+		if len(rest) == 0 {
+			return positional, nil, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// extractFlags parses the flags of fs wherever they appear in args and
+// returns all other arguments untouched. Everything after "--" is kept.
+func extractFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(rest, args[i+1:]...), nil
+		}
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if !strings.HasPrefix(arg, "-") || fs.Lookup(name) == nil {
+			rest = append(rest, arg)
+			continue
+		}
+		flagArgs := []string{arg}
+		if takesValue(fs, arg) && i+1 < len(args) {
+			i++
+			flagArgs = append(flagArgs, args[i])
+		}
+		if err := fs.Parse(flagArgs); err != nil {
+			return nil, err
+		}
+	}
+	return rest, nil
+}
+
+// Run executes the parsed command. cfg and resolveHost are nil when no config
+// file was loaded, which only commands marked NoConfig accept.
+func (inv *Invocation) Run(c context.Context, cfg *config.Config, resolveHost func() (string, error), cwdRel string) error {
+	return inv.Execute(NewContext(c, cfg, resolveHost, cwdRel))
+}
+
+// Execute runs the command in ctx with the arguments of the invocation. The
+// dry-run and verbose flags add to those of ctx.
+func (inv *Invocation) Execute(ctx *Context) error {
+	ctx.Args = inv.Args
+	ctx.Passthrough = inv.Passthrough
+	if inv.Options.DryRun != DryRunOff {
+		ctx.DryRun = inv.Options.DryRun
+	}
+	ctx.IsVerbose = ctx.IsVerbose || inv.Options.IsVerbose
+
+	start := time.Now()
+	err := inv.Command.Execute(ctx)
+	inv.audit(ctx, start, err)
+	if err != nil {
+		return err
+	}
+	if ctx.DryRun != DryRunOff && len(ctx.plan.Steps) > 0 {
+		return ctx.plan.Write(ctx.Stdout, ctx.DryRun)
+	}
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: remote [flags] <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, spec := range Specs() {
+		if strings.HasPrefix(spec.Name, "_") {
+			continue
+		}
+		fmt.Fprintf(w, "  %-10s %s\n", spec.Name, spec.Summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	printFlags(w, (&Options{}).SetFlags)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'remote help <command>' for details on a command.")
+}
+
+func printCommandUsage(w io.Writer, spec *Spec) {
+	fmt.Fprintf(w, "Usage: remote %s [flags] %s\n", spec.Name, spec.Usage)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, spec.Summary)
+	if len(spec.Aliases) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Aliases: %s\n", strings.Join(spec.Aliases, ", "))
+	}
+	var b strings.Builder
+	printFlags(&b, spec.New().SetFlags)
+	if b.Len() > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Flags:")
+		fmt.Fprint(w, b.String())
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	printFlags(w, (&Options{}).SetFlags)
+	if len(spec.Examples) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Examples:")
+		for _, example := range spec.Examples {
+			fmt.Fprintf(w, "  %s\n", example)
+		}
+	}
+}
+
+func printFlags(w io.Writer, setFlags func(fs *flag.FlagSet)) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	setFlags(fs)
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+type stringSlice []string
+
+func (i *stringSlice) String() string {
+	return fmt.Sprintf("%v", *i)
+}
+
+func (i *stringSlice) Set(value string) error {
+	*i = append(*i, value)
+	return nil
+}
@@ -0,0 +1,191 @@
+package command
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/yhiraki/remote/internal/logging"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCmd  string
+		wantArgs []string
+		wantPass []string
+		wantOpts Options
+		check    func(t *testing.T, cmd Command)
+		wantErr  bool
+	}{
+		{
+			name:     "no arguments",
+			args:     []string{},
+			wantCmd:  "sh",
+			wantArgs: []string{},
+		},
+		{
+			name:     "global flag before command",
+			args:     []string{"--dry-run", "push", "."},
+			wantCmd:  "push",
+			wantArgs: []string{"."},
+			wantOpts: Options{DryRun: DryRunText},
+		},
+		{
+			name:     "global flags before command are kept",
+			args:     []string{"--verbose", "--host", "dev", "tunnel", "8080"},
+			wantCmd:  "tunnel",
+			wantArgs: []string{"8080"},
+			wantOpts: Options{IsVerbose: true, Host: "dev"},
+		},
+		{
+			name:     "global flag after positional",
+			args:     []string{"push", ".", "--dry-run=json"},
+			wantCmd:  "push",
+			wantArgs: []string{"."},
+			wantOpts: Options{DryRun: DryRunJSON},
+		},
+		{
+			name:     "double dash ends flags",
+			args:     []string{"diff", "--", "--dry-run"},
+			wantCmd:  "diff",
+			wantArgs: []string{"--dry-run"},
+		},
+		{
+			name:     "arguments after double dash passed through",
+			args:     []string{"push", ".", "--verbose", "--", "--compress", "--dry-run"},
+			wantCmd:  "push",
+			wantArgs: []string{"."},
+			wantPass: []string{"--compress", "--dry-run"},
+			wantOpts: Options{IsVerbose: true},
+		},
+		{
+			name:     "command flag",
+			args:     []string{"tunnel", "8080", "--background", "3000"},
+			wantCmd:  "tunnel",
+			wantArgs: []string{"8080", "3000"},
+			check: func(t *testing.T, cmd Command) {
+				if !cmd.(*TunnelCommand).IsBackground {
+					t.Error("TunnelCommand.IsBackground = false, want true")
+				}
+			},
+		},
+		{
+			name:     "sh stops at remote command",
+			args:     []string{"sh", "-e", "FOO=1", "--verbose", "ls", "-la", "--dry-run"},
+			wantCmd:  "sh",
+			wantArgs: []string{"ls", "-la", "--dry-run"},
+			wantOpts: Options{IsVerbose: true},
+			check: func(t *testing.T, cmd Command) {
+				if got := cmd.(*SSHCommand).EnvVars; !reflect.DeepEqual([]string(got), []string{"FOO=1"}) {
+					t.Errorf("SSHCommand.EnvVars = %v, want [FOO=1]", got)
+				}
+			},
+		},
+		{
+			name:    "flag of another command",
+			args:    []string{"push", "--background", "."},
+			wantErr: true,
+		},
+		{
+			name:    "unknown command",
+			args:    []string{"unknown"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv, err := Parse(tt.args, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if inv.Spec.Name != tt.wantCmd {
+				t.Errorf("Parse() command = %v, want %v", inv.Spec.Name, tt.wantCmd)
+			}
+			if !reflect.DeepEqual(inv.Args, tt.wantArgs) {
+				t.Errorf("Parse() args = %v, want %v", inv.Args, tt.wantArgs)
+			}
+			if !reflect.DeepEqual(inv.Passthrough, tt.wantPass) {
+				t.Errorf("Parse() passthrough = %v, want %v", inv.Passthrough, tt.wantPass)
+			}
+			if inv.Options != tt.wantOpts {
+				t.Errorf("Parse() options = %+v, want %+v", inv.Options, tt.wantOpts)
+			}
+			if tt.check != nil {
+				tt.check(t, inv.Command)
+			}
+		})
+	}
+}
+
+func TestOptions_LogOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		env     string
+		want    logging.Options
+		wantErr bool
+	}{
+		{name: "default", want: logging.DefaultOptions},
+		{name: "verbose", opts: Options{IsVerbose: true}, want: logging.Options{Level: slog.LevelDebug, Format: "text"}},
+		{name: "level over verbose", opts: Options{IsVerbose: true, LogLevel: "error"}, want: logging.Options{Level: slog.LevelError, Format: "text"}},
+		{name: "env", env: "level=info,format=json,file=a.log", want: logging.Options{Level: slog.LevelInfo, Format: "json", File: "a.log"}},
+		{
+			name: "flags over env",
+			opts: Options{LogLevel: "debug", LogFormat: "text", LogFile: "b.log"},
+			env:  "level=info,format=json,file=a.log",
+			want: logging.Options{Level: slog.LevelDebug, Format: "text", File: "b.log"},
+		},
+		{name: "invalid level", opts: Options{LogLevel: "loud"}, wantErr: true},
+		{name: "invalid env", env: "format=yaml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.opts.LogOptions(tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LogOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("LogOptions() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_help(t *testing.T) {
+	usageOutput = io.Discard
+	defer func() { usageOutput = os.Stderr }()
+
+	for _, args := range [][]string{{"-h"}, {"push", "-h"}, {"sh", "--help"}} {
+		if _, err := Parse(args, nil); !errors.Is(err, flag.ErrHelp) {
+			t.Errorf("Parse(%v) error = %v, want %v", args, err, flag.ErrHelp)
+		}
+	}
+}
+
+func TestSpecs(t *testing.T) {
+	names := map[string]bool{}
+	prev := ""
+	for _, spec := range Specs() {
+		if spec.Name < prev {
+			t.Errorf("Specs() not sorted: %q after %q", spec.Name, prev)
+		}
+		prev = spec.Name
+		names[spec.Name] = true
+	}
+	for _, want := range []string{"help", "ip", "pull", "push", "sh", "tunnel"} {
+		if !names[want] {
+			t.Errorf("Specs() is missing %q", want)
+		}
+	}
+}
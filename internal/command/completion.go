@@ -0,0 +1,379 @@
+package command
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yhiraki/remote/internal/atomicfile"
+	"github.com/yhiraki/remote/internal/config"
+	"github.com/yhiraki/remote/internal/shell"
+)
+
+// remoteListCacheTTL is how long a listing of a remote directory is reused for completion.
+const remoteListCacheTTL = time.Minute
+
+func init() {
+	Register(&Spec{
+		Name:    "completion",
+		Usage:   "bash|zsh|fish",
+		Summary: "Print a shell completion script",
+		Examples: []string{
+			"source <(remote completion bash)",
+			"remote completion zsh > \"${fpath[1]}/_remote\"",
+			"remote completion fish > ~/.config/fish/completions/remote.fish",
+		},
+		NoConfig: true,
+		NoAudit:  true,
+		New:      func() Command { return &CompletionCommand{} },
+	})
+	Register(&Spec{
+		Name:     "__complete",
+		Usage:    "-- [words...]",
+		Summary:  "Print completion candidates for the last word of a command line",
+		NoConfig: true,
+		NoAudit:  true,
+		New:      func() Command { return &completeCommand{} },
+	})
+}
+
+// Completer is implemented by commands that complete their positional arguments.
+// args are the preceding positional arguments and toComplete the partial word.
+type Completer interface {
+	Complete(ctx *Context, args []string, toComplete string) []string
+}
+
+// flagValueCompleters complete the values of flags taking an argument.
+var flagValueCompleters = map[string]func(ctx *Context) []string{
+	"host": func(ctx *Context) []string {
+		if ctx.Config == nil {
+			return nil
+		}
+		return ctx.Config.HostNames()
+	},
+}
+
+type CompletionCommand struct{}
+
+func (c *CompletionCommand) SetFlags(fs *flag.FlagSet) {}
+
+func (c *CompletionCommand) Execute(ctx *Context) error {
+	if len(ctx.Args) != 1 {
+		return fmt.Errorf("Usage: remote completion bash|zsh|fish")
+	}
+	script, ok := completionScripts[ctx.Args[0]]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q (want bash, zsh or fish)", ctx.Args[0])
+	}
+	fmt.Fprint(ctx.Stdout, script)
+	return nil
+}
+
+func (c *CompletionCommand) Complete(ctx *Context, args []string, toComplete string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	return []string{"bash", "fish", "zsh"}
+}
+
+type completeCommand struct{}
+
+func (c *completeCommand) SetFlags(fs *flag.FlagSet) {}
+
+func (c *completeCommand) Execute(ctx *Context) error {
+	for _, candidate := range complete(ctx, ctx.Args) {
+		fmt.Fprintln(ctx.Stdout, candidate)
+	}
+	return nil
+}
+
+// complete returns the candidates for the last element of words,
+// which holds the command line following the program name.
+func complete(ctx *Context, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	toComplete := words[len(words)-1]
+	words = words[:len(words)-1]
+
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	(&Options{}).SetFlags(fs)
+
+	var spec *Spec
+	i := 0
+	for ; i < len(words) && spec == nil; i++ {
+		if strings.HasPrefix(words[i], "-") {
+			if takesValue(fs, words[i]) {
+				i++
+			}
+			continue
+		}
+		var ok bool
+		if spec, ok = Lookup(words[i], ctx.Config); !ok {
+			return nil
+		}
+	}
+
+	if i > len(words) {
+		// the word is the value of the preceding flag
+		return filterPrefix(completeFlagValue(ctx, words[len(words)-1]), toComplete)
+	}
+
+	if spec == nil {
+		if strings.HasPrefix(toComplete, "-") {
+			return filterPrefix(flagNames(fs), toComplete)
+		}
+		return filterPrefix(commandNames(ctx.Config), toComplete)
+	}
+
+	if spec.RawArgs {
+		return nil
+	}
+	cmd := spec.New()
+	cmd.SetFlags(fs)
+	args := []string{}
+	for ; i < len(words); i++ {
+		if strings.HasPrefix(words[i], "-") && (spec.Interspersed || len(args) == 0) {
+			if takesValue(fs, words[i]) {
+				if i == len(words)-1 {
+					return filterPrefix(completeFlagValue(ctx, words[i]), toComplete)
+				}
+				i++
+			}
+			continue
+		}
+		args = append(args, words[i])
+	}
+
+	if strings.HasPrefix(toComplete, "-") && (spec.Interspersed || len(args) == 0) {
+		return filterPrefix(flagNames(fs), toComplete)
+	}
+	if c, ok := cmd.(Completer); ok {
+		return filterPrefix(c.Complete(ctx, args, toComplete), toComplete)
+	}
+	return nil
+}
+
+// commandNames returns the names of the commands shown to users,
+// followed by the aliases and tasks defined in cfg, which may be nil,
+// and by the plugins of the plugins directory.
+func commandNames(cfg *config.Config) []string {
+	var names []string
+	for _, spec := range Specs() {
+		if !strings.HasPrefix(spec.Name, "_") {
+			names = append(names, spec.Name)
+		}
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		seen[name] = true
+	}
+	if cfg != nil {
+		for _, name := range cfg.TaskNames() {
+			if !seen[name] {
+				names = append(names, name)
+				seen[name] = true
+			}
+		}
+	}
+	var plugins []string
+	for name := range listPlugins(cfg, false) {
+		if !seen[name] {
+			plugins = append(plugins, name)
+		}
+	}
+	sort.Strings(plugins)
+	return append(names, plugins...)
+}
+
+// takesValue reports whether word is a flag which consumes the following word.
+func takesValue(fs *flag.FlagSet, word string) bool {
+	name := strings.TrimLeft(word, "-")
+	if name == "" || strings.Contains(name, "=") {
+		return false
+	}
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return false
+	}
+	return true
+}
+
+func completeFlagValue(ctx *Context, word string) []string {
+	if complete, ok := flagValueCompleters[strings.TrimLeft(word, "-")]; ok {
+		return complete(ctx)
+	}
+	return nil
+}
+
+func flagNames(fs *flag.FlagSet) []string {
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if len(f.Name) == 1 {
+			names = append(names, "-"+f.Name)
+		} else {
+			names = append(names, "--"+f.Name)
+		}
+	})
+	return names
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	var matched []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matched = append(matched, c)
+		}
+	}
+	return matched
+}
+
+// splitDir splits a partial path into its directory part, including the
+// trailing slash, and the rest.
+func splitDir(path string) string {
+	return path[:strings.LastIndex(path, "/")+1]
+}
+
+// completeLocalPath lists the local entries matching the partial path.
+func completeLocalPath(toComplete string) []string {
+	dir := splitDir(toComplete)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+	var candidates []string
+	for _, e := range entries {
+		name := dir + e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		candidates = append(candidates, name)
+	}
+	return candidates
+}
+
+// completeRemotePath lists the remote entries matching the partial path,
+// relative to the directory mapped to the current one.
+func completeRemotePath(ctx *Context, toComplete string) []string {
+	if ctx.Config == nil {
+		return nil
+	}
+	remoteHost, err := ctx.RemoteHost()
+	if err != nil {
+		return nil
+	}
+	dir := splitDir(toComplete)
+	names, err := listRemoteDir(ctx, remoteHost, dir)
+	if err != nil {
+		return nil
+	}
+	candidates := make([]string, 0, len(names))
+	for _, name := range names {
+		candidates = append(candidates, dir+name)
+	}
+	return candidates
+}
+
+// listRemoteDir returns the entries of dir on the remote host, with a trailing
+// slash for directories. Listings are cached in CacheDir for remoteListCacheTTL.
+func listRemoteDir(ctx *Context, remoteHost, dir string) ([]string, error) {
+	cacheFile := remoteListCacheFile(ctx, remoteHost, dir)
+
+	if st, err := os.Stat(cacheFile); err == nil && time.Since(st.ModTime()) < remoteListCacheTTL {
+		if content, err := os.ReadFile(cacheFile); err == nil {
+			return splitLines(string(content)), nil
+		}
+	}
+
+	target := dir
+	if target == "" {
+		target = "."
+	}
+	remoteCmd := fmt.Sprintf("cd %s && ls -1Ap -- %s", shell.Quote(ctx.CwdRel), shell.Quote(target))
+	// keys are not pinned while completing, which must not run hostKeyCommand
+	opts, err := hostKeyOptions(ctx, remoteHost, false)
+	if err != nil {
+		return nil, err
+	}
+	sshArgs := append([]string{"-T", "-o", "BatchMode=yes", "-o", "ConnectTimeout=5"}, opts...)
+	out, err := exec.CommandContext(ctx.Ctx, "ssh", append(sshArgs, remoteHost, remoteCmd)...).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0o705); err == nil {
+		atomicfile.WriteFile(cacheFile, out, 0o644)
+	}
+	return splitLines(string(out)), nil
+}
+
+func remoteListCacheFile(ctx *Context, remoteHost, dir string) string {
+	sum := sha1.Sum([]byte(remoteHost + "\x00" + ctx.CwdRel + "\x00" + dir))
+	return filepath.Join(ctx.Config.CacheDir, "completion", hex.EncodeToString(sum[:]))
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for remote
+_remote() {
+    local IFS=$'\n'
+    COMPREPLY=($(remote __complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+        compopt -o nospace
+    fi
+}
+complete -F _remote remote
+`,
+	"zsh": `#compdef remote
+# zsh completion for remote
+_remote() {
+    local -a candidates
+    local c
+    candidates=("${(@f)$(remote __complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    for c in $candidates; do
+        [[ -z $c ]] && continue
+        if [[ $c == */ ]]; then
+            compadd -S '' -- "$c"
+        else
+            compadd -- "$c"
+        fi
+    done
+}
+if [[ $funcstack[1] == _remote ]]; then
+    _remote "$@"
+else
+    compdef _remote remote
+fi
+`,
+	"fish": `# fish completion for remote
+function __remote_complete
+    set -l tokens (commandline -opc) (commandline -ct)
+    remote __complete -- $tokens[2..-1] 2>/dev/null
+end
+complete -c remote -f -a '(__remote_complete)'
+`,
+}
@@ -0,0 +1,101 @@
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func TestComplete(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		CacheDir: tmpDir,
+		Hosts: map[string]*config.Host{
+			"dev":  {Hostname: "dev.example.com"},
+			"prod": {Hostname: "prod.example.com"},
+		},
+		Tunnels: map[string]config.Ports{
+			"web": {"8080"},
+			"db":  {"5432"},
+		},
+		Tasks: map[string]*config.Task{
+			"deploy": {},
+		},
+	}
+	ctx := &Context{
+		Config:      cfg,
+		CwdRel:      "src",
+		resolveHost: func() (string, error) { return "example.com", nil },
+		plan:        &Plan{},
+	}
+
+	// pre-populate the listing cache so that no ssh connection is made
+	cacheFile := remoteListCacheFile(ctx, "example.com", "build/")
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cacheFile, []byte("app.log\nout/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		words []string
+		want  []string
+	}{
+		{name: "commands", words: []string{"pu"}, want: []string{"pull", "push"}},
+		{name: "commands after global flag", words: []string{"--verbose", "tu"}, want: []string{"tunnel"}},
+		{name: "global flags", words: []string{"--dr"}, want: []string{"--dry-run"}},
+		{name: "command flags", words: []string{"tunnel", "--b"}, want: []string{"--background"}},
+		{name: "host profiles", words: []string{"--host", ""}, want: []string{"dev", "prod"}},
+		{name: "host profiles after command", words: []string{"push", "--host", "p"}, want: []string{"prod"}},
+		{name: "tunnel profiles", words: []string{"tunnel", "8080", ""}, want: []string{"db", "web"}},
+		{name: "help topics", words: []string{"help", "co"}, want: []string{"completion"}},
+		{name: "shells", words: []string{"completion", ""}, want: []string{"bash", "fish", "zsh"}},
+		{name: "remote paths", words: []string{"pull", "build/"}, want: []string{"build/app.log", "build/out/"}},
+		{name: "remote command is not completed", words: []string{"sh", "ls", "-"}, want: nil},
+		{name: "unknown command", words: []string{"unknown", ""}, want: nil},
+		{name: "tasks", words: []string{"de"}, want: []string{"deploy"}},
+		{name: "task names", words: []string{"task", "run", ""}, want: []string{"deploy"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := complete(ctx, tt.words)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("complete(%q) = %q, want %q", tt.words, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleteLocalPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmpDir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "file.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := completeLocalPath(tmpDir + "/")
+	want := []string{tmpDir + "/file.txt", tmpDir + "/sub/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("completeLocalPath() = %v, want %v", got, want)
+	}
+}
+
+func TestCompletionCommand(t *testing.T) {
+	for shell, script := range completionScripts {
+		if !strings.Contains(script, "remote __complete --") {
+			t.Errorf("%s completion script does not call remote __complete", shell)
+		}
+	}
+	if err := (&CompletionCommand{}).Execute(&Context{Args: []string{"tcsh"}}); err == nil {
+		t.Error("CompletionCommand.Execute() expected error for unsupported shell, got nil")
+	}
+}
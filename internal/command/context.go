@@ -1,15 +1,103 @@
 package command
 
-import "github.com/yhiraki/remote/internal/config"
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/yhiraki/remote/internal/config"
+	"github.com/yhiraki/remote/internal/rsync"
+)
 
 type Context struct {
-	Config       *config.Config
-	RemoteHost   string
-	Args         []string
-	EnvVars      []string
-	IsDryRun     bool
-	IsBackground bool
-	IsVerbose    bool
-	CwdRel       string
+	Ctx       context.Context
+	Config    *config.Config
+	Args      []string
+	DryRun    DryRunMode
+	IsVerbose bool
+	CwdRel    string
+	// Passthrough holds the arguments given after "--" to commands marked
+	// Passthrough, for the tool they run.
+	Passthrough []string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	resolveHost func() (string, error)
+	plan        *Plan
+	// transferred totals the bytes transferred by rsync, for the audit log.
+	transferred *rsync.Stats
+}
+
+// NewContext returns a Context running commands against the host returned by
+// resolveHost in the remote directory cwdRel, connected to the standard streams.
+func NewContext(ctx context.Context, cfg *config.Config, resolveHost func() (string, error), cwdRel string) *Context {
+	if resolveHost != nil {
+		resolveHost = memoize(resolveHost)
+	}
+	c := &Context{
+		Ctx:         ctx,
+		Config:      cfg,
+		CwdRel:      cwdRel,
+		Stdin:       os.Stdin,
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+		resolveHost: resolveHost,
+		plan:        &Plan{},
+		transferred: &rsync.Stats{},
+	}
+	if cfg != nil {
+		c.plan.ConfigSource = cfg.Source
+	}
+	return c
+}
+
+// RemoteHost resolves the remote hostname.
+func (ctx *Context) RemoteHost() (string, error) {
+	if ctx.resolveHost == nil {
+		return "", errors.New("no config file found to resolve the remote host")
+	}
+	h, err := ctx.resolveHost()
+	if err != nil {
+		return "", err
+	}
+	ctx.plan.Host = h
+	return h, nil
 }
 
+// Steps returns the processes run, or planned in dry-run mode, so far.
+func (ctx *Context) Steps() []Step {
+	return ctx.plan.Steps
+}
+
+// addTransferred adds the bytes transferred by a finished rsync to the
+// totals of ctx.
+func (ctx *Context) addTransferred(s rsync.Stats) {
+	if ctx.transferred == nil {
+		return
+	}
+	ctx.transferred.BytesSent += s.BytesSent
+	ctx.transferred.BytesReceived += s.BytesReceived
+}
+
+// withArgs returns a copy of ctx for running another command with args.
+func (ctx *Context) withArgs(args []string) *Context {
+	c := *ctx
+	c.Args = args
+	return &c
+}
+
+// memoize returns a function calling resolve only until it succeeds.
+func memoize(resolve func() (string, error)) func() (string, error) {
+	var h string
+	return func() (string, error) {
+		if h != "" {
+			return h, nil
+		}
+		var err error
+		h, err = resolve()
+		return h, err
+	}
+}
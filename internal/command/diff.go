@@ -0,0 +1,198 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/yhiraki/remote/internal/bisync"
+	"github.com/yhiraki/remote/internal/shell"
+)
+
+func init() {
+	Register(&Spec{
+		Name:         "diff",
+		Usage:        "[path]",
+		Summary:      "List the files differing from the remote host, or show a unified diff of one file",
+		Examples:     []string{"remote diff", "remote diff --format json src", "remote diff src/main.go"},
+		Interspersed: true,
+		New:          func() Command { return &DiffCommand{} },
+	})
+}
+
+// presentMarker is printed before the content of a remote file, to tell an
+// empty file from a missing one.
+const presentMarker = "present\n"
+
+type DiffCommand struct {
+	Format string
+}
+
+// FileDiff is a file differing between the local and the remote trees.
+// Status is from the point of view of a push: "added" files exist only
+// locally and "deleted" ones only on the remote host.
+type FileDiff struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Diff   string `json:"diff,omitempty"`
+}
+
+func (c *DiffCommand) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Format, "format", "text", "output format: text or json")
+}
+
+func (c *DiffCommand) Complete(ctx *Context, args []string, toComplete string) []string {
+	return completeLocalPath(toComplete)
+}
+
+func (c *DiffCommand) Execute(ctx *Context) error {
+	if len(ctx.Args) > 1 {
+		return errors.New("Usage: remote diff [path]")
+	}
+	if c.Format != "text" && c.Format != "json" {
+		return fmt.Errorf("invalid format %q (want text or json)", c.Format)
+	}
+	local := "."
+	if len(ctx.Args) == 1 {
+		local = ctx.Args[0]
+	}
+	remoteHost, err := ctx.RemoteHost()
+	if err != nil {
+		return err
+	}
+
+	var diffs []FileDiff
+	if st, err := os.Stat(local); err == nil && st.IsDir() {
+		diffs, err = diffTree(ctx, remoteHost, local)
+		if err != nil {
+			return err
+		}
+	} else {
+		d, err := diffFile(ctx, remoteHost, local)
+		if err != nil {
+			return err
+		}
+		if d != nil {
+			diffs = append(diffs, *d)
+		}
+	}
+
+	// in dry-run mode stdout is left to the plan
+	w := ctx.Stdout
+	if ctx.DryRun != DryRunOff {
+		w = ctx.Stderr
+	}
+	if c.Format == "json" {
+		if diffs == nil {
+			diffs = []FileDiff{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diffs)
+	}
+	for _, d := range diffs {
+		if d.Diff != "" {
+			fmt.Fprint(w, d.Diff)
+			continue
+		}
+		fmt.Fprintf(w, "%c %s\n", strings.ToUpper(d.Status)[0], d.Path)
+	}
+	return nil
+}
+
+// diffTree compares the hashes of the files under the local dir with those
+// of the corresponding remote directory.
+func diffTree(ctx *Context, remoteHost, dir string) ([]FileDiff, error) {
+	exclude := transferExcludes(ctx, dir)
+	local, err := bisync.HashDir(dir, exclude)
+	if err != nil {
+		return nil, err
+	}
+	out, _, err := hashRemoteDir(ctx, remoteHost, remotePath(ctx.CwdRel, dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote files: %w", err)
+	}
+	// with no previous state, every difference is an addition on one side
+	var diffs []FileDiff
+	for _, ch := range bisync.Reconcile(nil, local, bisync.ParseHashes(out, exclude)) {
+		d := FileDiff{Path: ch.Path, Status: "modified"}
+		if ch.Remote == bisync.Absent {
+			d.Status = "added"
+		} else if ch.Local == bisync.Absent {
+			d.Status = "deleted"
+		}
+		diffs = append(diffs, d)
+	}
+	return diffs, nil
+}
+
+// diffFile returns the unified diff from the remote to the local version of
+// file, or nil if they are the same.
+func diffFile(ctx *Context, remoteHost, file string) (*FileDiff, error) {
+	remoteCmd := fmt.Sprintf("if [ -f %[1]s ]; then printf %[2]s; cat -- %[1]s; fi", shell.Quote(remotePath(ctx.CwdRel, file)), shell.Quote(presentMarker))
+	out, err := readRemote(ctx, remoteHost, remoteCmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read remote file: %w", err)
+	}
+	content, remoteExists := bytes.CutPrefix(out, []byte(presentMarker))
+	_, err = os.Stat(file)
+	localExists := err == nil
+	if !localExists && !remoteExists {
+		return nil, fmt.Errorf("File not found locally nor on the remote host: %q", file)
+	}
+
+	remoteFile := os.DevNull
+	if remoteExists {
+		tmp, err := os.CreateTemp("", "remote-diff-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+		_, err = tmp.Write(content)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		remoteFile = tmp.Name()
+	}
+	localFile := file
+	if !localExists {
+		localFile = os.DevNull
+	}
+
+	name := filepath.ToSlash(file)
+	diff, err := exec.CommandContext(ctx.Ctx, "diff", "-u", "--label", "remote/"+name, "--label", "local/"+name, remoteFile, localFile).Output()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+	default:
+		return nil, err
+	}
+
+	d := &FileDiff{Path: name, Status: "modified", Diff: string(diff)}
+	if !remoteExists {
+		d.Status = "added"
+	} else if !localExists {
+		d.Status = "deleted"
+	}
+	return d, nil
+}
+
+// remotePath returns the remote path corresponding to the local path p.
+func remotePath(cwdRel, p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.ToSlash(p)
+	}
+	return path.Join(cwdRel, filepath.ToSlash(p))
+}
@@ -0,0 +1,111 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func TestDiffCommand_tree(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "local", "b.txt": "same", "c.txt": "new"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fakeSync(t, map[string]string{"a.txt": "remote", "b.txt": "same", "d.txt": "old"})
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: "text", want: "M a.txt\nA c.txt\nD d.txt\n"},
+		{format: "json", want: `[
+  {
+    "path": "a.txt",
+    "status": "modified"
+  },
+  {
+    "path": "c.txt",
+    "status": "added"
+  },
+  {
+    "path": "d.txt",
+    "status": "deleted"
+  }
+]
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var stdout bytes.Buffer
+			ctx := NewContext(context.Background(), &config.Config{}, func() (string, error) { return "example.com", nil }, ".")
+			ctx.Args = []string{dir}
+			ctx.Stdout = &stdout
+			if err := (&DiffCommand{Format: tt.format}).Execute(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.want)
+			}
+		})
+	}
+
+	t.Run("dry-run", func(t *testing.T) {
+		cfg := &config.Config{}
+		inv, err := Parse([]string{"--dry-run=json", "diff", dir}, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var stdout, stderr bytes.Buffer
+		ctx := NewContext(context.Background(), cfg, func() (string, error) { return "example.com", nil }, ".")
+		ctx.Stdout = &stdout
+		ctx.Stderr = &stderr
+		if err := inv.Execute(ctx); err != nil {
+			t.Fatal(err)
+		}
+		var plan Plan
+		if err := json.Unmarshal(stdout.Bytes(), &plan); err != nil {
+			t.Fatalf("stdout is not a JSON plan: %v\n%s", err, stdout.String())
+		}
+		if len(plan.Steps) != 1 || plan.Steps[0].Command != "ssh" {
+			t.Errorf("steps = %+v, want the remote scan", plan.Steps)
+		}
+		if want := "M a.txt\nA c.txt\nD d.txt\n"; stderr.String() != want {
+			t.Errorf("stderr = %q, want %q", stderr.String(), want)
+		}
+	})
+}
+
+func TestDiffCommand_file(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(file, []byte("package main\n\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\nprintf 'present\\npackage main\\n\\nfunc old() {}\\n'\n"
+	if err := os.WriteFile(filepath.Join(bin, "ssh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var stdout bytes.Buffer
+	ctx := NewContext(context.Background(), &config.Config{}, func() (string, error) { return "example.com", nil }, ".")
+	ctx.Args = []string{file}
+	ctx.Stdout = &stdout
+	if err := (&DiffCommand{Format: "text"}).Execute(ctx); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.ToSlash(file)
+	want := "--- remote/" + name + "\n+++ local/" + name + "\n@@ -1,3 +1,3 @@\n package main\n \n-func old() {}\n+func main() {}\n"
+	if stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+}
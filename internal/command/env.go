@@ -0,0 +1,184 @@
+package command
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yhiraki/remote/internal/term"
+)
+
+// EnvTransport is how the values of environment variables set with -e reach
+// the remote command.
+type EnvTransport string
+
+const (
+	// EnvAuto selects EnvStdin, or EnvArgv when stdin is a terminal.
+	EnvAuto EnvTransport = ""
+	// EnvArgv sets the variables on the remote command line, where other
+	// users of both hosts may see them in the process list.
+	EnvArgv EnvTransport = "argv"
+	// EnvStdin sends the variables on the first line of stdin, read by the
+	// remote shell before running the command. It needs stdin not to be a
+	// terminal.
+	EnvStdin EnvTransport = "stdin"
+	// EnvSendEnv passes the variables with the SendEnv option of ssh. The
+	// server must accept them with AcceptEnv, or they are silently dropped,
+	// so it is only used when selected.
+	EnvSendEnv EnvTransport = "sendenv"
+)
+
+// secretMask replaces the values of environment variables in dry-run output
+// and logs.
+const secretMask = "***"
+
+// parseEnvTransport returns the transport named s, EnvAuto if s is empty.
+func parseEnvTransport(s string) (EnvTransport, error) {
+	switch t := EnvTransport(s); t {
+	case EnvAuto, EnvArgv, EnvStdin, EnvSendEnv:
+		return t, nil
+	}
+	return "", fmt.Errorf("invalid envTransport %q (want stdin, sendenv or argv)", s)
+}
+
+// autoEnvTransport returns the transport selected by EnvAuto: EnvStdin, or
+// EnvArgv when the remote command reads a terminal, which has no line of
+// variables to read first.
+func autoEnvTransport(stdin io.Reader, tty bool) EnvTransport {
+	if f, ok := stdin.(*os.File); tty || ok && term.IsTerminal(f) {
+		return EnvArgv
+	}
+	return EnvStdin
+}
+
+// resolveEnv returns the KEY=VALUE pairs of the variables in files, then in
+// vars. A variable given as KEY alone takes its value from the local
+// environment.
+func resolveEnv(vars, files []string) ([]string, error) {
+	var env []string
+	for _, f := range files {
+		pairs, err := readEnvFile(f)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, pairs...)
+	}
+	for _, v := range vars {
+		key, _, ok := strings.Cut(v, "=")
+		if !ok {
+			value, set := os.LookupEnv(key)
+			if !set {
+				return nil, fmt.Errorf("environment variable %s is not set locally", key)
+			}
+			v = key + "=" + value
+		}
+		if !validEnvName(key) {
+			return nil, fmt.Errorf("invalid environment variable name %q", key)
+		}
+		env = append(env, v)
+	}
+	return env, nil
+}
+
+// readEnvFile reads the KEY=VALUE pairs of a .env file.
+func readEnvFile(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	env, err := parseEnvFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return env, nil
+}
+
+// parseEnvFile parses lines of KEY=VALUE, optionally preceded by "export".
+// Values may be single quoted, taken literally, or double quoted, where \n,
+// \" and \\ are unescaped. Unquoted values end at " #".
+func parseEnvFile(r io.Reader) ([]string, error) {
+	var env []string
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !validEnvName(key) {
+			return nil, fmt.Errorf("line %d: want KEY=VALUE", n)
+		}
+		value, err := unquoteEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		env = append(env, key+"="+value)
+	}
+	return env, sc.Err()
+}
+
+func unquoteEnvValue(v string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	switch q := v[0]; q {
+	case '\'', '"':
+		end := strings.LastIndexByte(v, q)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated quote")
+		}
+		if q == '\'' {
+			return v[1:end], nil
+		}
+		return strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(v[1:end]), nil
+	}
+	if i := strings.Index(v, " #"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	return v, nil
+}
+
+func validEnvName(s string) bool {
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		return false
+	}
+	for _, r := range s {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// maskEnv returns env with the values replaced by secretMask.
+func maskEnv(env []string) []string {
+	masked := make([]string, len(env))
+	for i, v := range env {
+		key, _, _ := strings.Cut(v, "=")
+		masked[i] = key + "=" + secretMask
+	}
+	return masked
+}
+
+// envFiles returns the env files of the config, relative to its directory,
+// followed by extra.
+func envFiles(ctx *Context, extra string) []string {
+	var files []string
+	if cfg := ctx.Config; cfg != nil && cfg.EnvFile != "" {
+		f := cfg.EnvFile
+		if !filepath.IsAbs(f) && cfg.Source != "" {
+			f = filepath.Join(filepath.Dir(cfg.Source), f)
+		}
+		files = append(files, f)
+	}
+	if extra != "" {
+		files = append(files, extra)
+	}
+	return files
+}
@@ -0,0 +1,157 @@
+package command
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	content := `# comment
+PLAIN=value
+export EXPORTED=1
+SPACED = spaced value # comment
+SINGLE='$HOME # kept'
+DOUBLE="line1\nline2 \"quoted\""
+EMPTY=
+`
+	got, err := parseEnvFile(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"PLAIN=value",
+		"EXPORTED=1",
+		"SPACED=spaced value",
+		"SINGLE=$HOME # kept",
+		"DOUBLE=line1\nline2 \"quoted\"",
+		"EMPTY=",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEnvFile() = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"NOVALUE\n", "1KEY=x\n", "KEY='unterminated\n"} {
+		if _, err := parseEnvFile(strings.NewReader(bad)); err == nil {
+			t.Errorf("parseEnvFile(%q) expected error, got nil", bad)
+		}
+	}
+}
+
+func TestResolveEnv(t *testing.T) {
+	t.Setenv("REMOTE_TEST_TOKEN", "s3cret")
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if err := os.WriteFile(envFile, []byte("FROM_FILE=1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := resolveEnv([]string{"DEBUG=1", "REMOTE_TEST_TOKEN"}, []string{envFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"FROM_FILE=1", "DEBUG=1", "REMOTE_TEST_TOKEN=s3cret"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveEnv() = %q, want %q", got, want)
+	}
+
+	if _, err := resolveEnv([]string{"REMOTE_TEST_UNSET"}, nil); err == nil {
+		t.Error("resolveEnv() expected error for an unset variable, got nil")
+	}
+	if _, err := resolveEnv([]string{"BAD-NAME=1"}, nil); err == nil {
+		t.Error("resolveEnv() expected error for an invalid name, got nil")
+	}
+	if _, err := resolveEnv(nil, []string{filepath.Join(dir, "missing")}); err == nil {
+		t.Error("resolveEnv() expected error for a missing file, got nil")
+	}
+}
+
+func TestSSHCommand_envMasked(t *testing.T) {
+	t.Setenv("REMOTE_TEST_TOKEN", "s3cret")
+	tests := []struct {
+		transport EnvTransport
+		wantArgs  []string
+		wantEnv   []string
+	}{
+		{EnvArgv, []string{"example.com", "-T", "cd proj; exec env 'REMOTE_TEST_TOKEN=***' make"}, []string{"REMOTE_TEST_TOKEN=***"}},
+		{EnvSendEnv, []string{"-o", "SendEnv=REMOTE_TEST_TOKEN", "example.com", "-T", "cd proj; exec make"}, []string{"REMOTE_TEST_TOKEN=***"}},
+		{EnvStdin, []string{"example.com", "-T", `cd proj; IFS= read -r REMOTE_ENV && eval "export $REMOTE_ENV" && unset REMOTE_ENV || exit 1; exec make`}, []string{"REMOTE_TEST_TOKEN=***"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.transport), func(t *testing.T) {
+			ctx := NewContext(context.Background(), &config.Config{}, func() (string, error) { return "example.com", nil }, "proj")
+			ctx.DryRun = DryRunText
+			ctx.Stdin = strings.NewReader("")
+			c := &SSHCommand{EnvVars: stringSlice{"REMOTE_TEST_TOKEN"}, TTY: TTYDisable, Transport: tt.transport}
+			if err := c.Execute(ctx.withArgs([]string{"make"})); err != nil {
+				t.Fatal(err)
+			}
+			step := ctx.Steps()[0]
+			if !reflect.DeepEqual(step.Args, tt.wantArgs) || !reflect.DeepEqual(step.Env, tt.wantEnv) {
+				t.Errorf("step = %q %q, want %q %q", step.Env, step.Args, tt.wantEnv, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestSSHCommand_envAuto(t *testing.T) {
+	tests := []struct {
+		name string
+		tty  TTYMode
+		want EnvTransport
+	}{
+		{name: "pipe", tty: TTYDisable, want: EnvStdin},
+		{name: "tty", tty: TTYForce, want: EnvArgv},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContext(context.Background(), &config.Config{}, func() (string, error) { return "example.com", nil }, "proj")
+			ctx.DryRun = DryRunText
+			ctx.Stdin = strings.NewReader("")
+			c := &SSHCommand{EnvVars: stringSlice{"TOKEN=s3cret"}, TTY: tt.tty}
+			if err := c.Execute(ctx.withArgs([]string{"make"})); err != nil {
+				t.Fatal(err)
+			}
+			if c.Transport != tt.want {
+				t.Errorf("Transport = %q, want %q", c.Transport, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSHCommand_envStdin(t *testing.T) {
+	dir := t.TempDir()
+	// a fake ssh running the remote command line locally
+	script := "#!/bin/sh\nfor a; do last=$a; done\nexec sh -c \"$last\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var stdout strings.Builder
+	ctx := NewContext(context.Background(), &config.Config{EnvTransport: "stdin"}, func() (string, error) { return "example.com", nil }, ".")
+	ctx.Stdin = strings.NewReader("piped input")
+	ctx.Stdout = &stdout
+	c := &SSHCommand{EnvVars: stringSlice{"TOKEN=it's $ecret", "OTHER=2"}, TTY: TTYDisable}
+	if err := c.Execute(ctx.withArgs([]string{"sh", "-c", `printf '%s|%s|' "$TOKEN" "$OTHER"; cat`})); err != nil {
+		t.Fatal(err)
+	}
+	if want := "it's $ecret|2|piped input"; stdout.String() != want {
+		t.Errorf("output = %q, want %q", stdout.String(), want)
+	}
+	for _, arg := range ctx.Steps()[0].Args {
+		if strings.Contains(arg, "ecret") {
+			t.Errorf("value found in the arguments: %q", ctx.Steps()[0].Args)
+		}
+	}
+
+	c = &SSHCommand{EnvVars: stringSlice{"TOKEN=a\nb"}, TTY: TTYDisable}
+	if err := c.Execute(ctx.withArgs([]string{"true"})); err == nil {
+		t.Error("Execute() expected error for a value with a newline, got nil")
+	}
+}
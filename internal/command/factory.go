@@ -1,19 +1,83 @@
 package command
 
-import "fmt"
-
-func NewCommand(subCmd string) (Command, error) {
-	switch subCmd {
-	case "ip":
-		return &IPCommand{}, nil
-	case "", "sh":
-		return &SSHCommand{}, nil
-	case "push", "pull":
-		return &RsyncCommand{Direction: subCmd}, nil
-	case "tunnel":
-		return &TunnelCommand{}, nil
-	default:
-		return nil, fmt.Errorf("%q is not a valid command", subCmd)
+import (
+	"fmt"
+	"sort"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+// Spec describes a subcommand and how to create it.
+type Spec struct {
+	Name     string
+	Aliases  []string
+	Usage    string // arguments following the command name
+	Summary  string
+	Examples []string
+
+	// Interspersed allows flags to follow positional arguments.
+	// Commands passing their arguments on to the remote host leave it unset.
+	Interspersed bool
+	// RawArgs passes all arguments following the command name on unparsed.
+	RawArgs bool
+	// Passthrough keeps the arguments following "--" apart from the positional
+	// arguments, for the command to pass on to the tool it runs.
+	Passthrough bool
+	// NoConfig marks commands that also run without a config file.
+	// Context.Config is nil for them when none could be loaded.
+	NoConfig bool
+	// NoAudit keeps the command out of the audit log.
+	NoAudit bool
+
+	New func() Command
+}
+
+var registry = map[string]*Spec{}
+
+// Register adds spec to the set of available subcommands.
+func Register(spec *Spec) {
+	for _, name := range append([]string{spec.Name}, spec.Aliases...) {
+		if _, ok := registry[name]; ok {
+			panic(fmt.Sprintf("command %q registered twice", name))
+		}
+		registry[name] = spec
 	}
 }
 
+// Lookup returns the spec registered under name or one of its aliases,
+// falling back to the aliases and tasks defined in cfg, which may be nil,
+// and then to plugin executables.
+func Lookup(name string, cfg *config.Config) (*Spec, bool) {
+	if name == "" {
+		name = defaultCommand
+	}
+	if spec, ok := registry[name]; ok {
+		return spec, true
+	}
+	if cfg != nil {
+		if spec, ok := taskSpec(name, cfg); ok {
+			return spec, true
+		}
+	}
+	return pluginSpec(name, cfg)
+}
+
+// Specs returns all registered subcommands sorted by name.
+func Specs() []*Spec {
+	specs := make([]*Spec, 0, len(registry))
+	for name, spec := range registry {
+		if name == spec.Name {
+			specs = append(specs, spec)
+		}
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
+
+func NewCommand(subCmd string, cfg *config.Config) (Command, error) {
+	spec, ok := Lookup(subCmd, cfg)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a valid command", subCmd)
+	}
+	return spec.New(), nil
+}
@@ -57,7 +57,7 @@ func TestNewCommand(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := NewCommand(tt.subCmd)
+			got, err := NewCommand(tt.subCmd, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewCommand() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -86,4 +86,3 @@ func TestNewCommand(t *testing.T) {
 		})
 	}
 }
-
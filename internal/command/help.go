@@ -0,0 +1,42 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+)
+
+func init() {
+	Register(&Spec{
+		Name:     "help",
+		Usage:    "[command]",
+		Summary:  "Show help for remote or one of its commands",
+		Examples: []string{"remote help push"},
+		NoConfig: true,
+		NoAudit:  true,
+		New:      func() Command { return &HelpCommand{} },
+	})
+}
+
+type HelpCommand struct{}
+
+func (c *HelpCommand) SetFlags(fs *flag.FlagSet) {}
+
+func (c *HelpCommand) Execute(ctx *Context) error {
+	if len(ctx.Args) == 0 {
+		printUsage(ctx.Stdout)
+		return nil
+	}
+	spec, ok := Lookup(ctx.Args[0], ctx.Config)
+	if !ok {
+		return fmt.Errorf("%q is not a valid command. See 'remote help'.", ctx.Args[0])
+	}
+	printCommandUsage(ctx.Stdout, spec)
+	return nil
+}
+
+func (c *HelpCommand) Complete(ctx *Context, args []string, toComplete string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	return commandNames(ctx.Config)
+}
@@ -0,0 +1,140 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/yhiraki/remote/internal/audit"
+	"github.com/yhiraki/remote/internal/shell"
+)
+
+func init() {
+	Register(&Spec{
+		Name:    "history",
+		Usage:   "[search]",
+		Summary: "List the past invocations of remote from the audit log, or run one again",
+		Examples: []string{
+			"remote history",
+			"remote history -n 100 --command push --failed",
+			"remote --host gpu history deploy",
+			"remote history --rerun 42",
+		},
+		Interspersed: true,
+		NoAudit:      true,
+		New:          func() Command { return &HistoryCommand{} },
+	})
+}
+
+type HistoryCommand struct {
+	Limit   int
+	Command string
+	Failed  bool
+	Format  string
+	Rerun   int64
+	Yes     bool // rerun without asking for confirmation
+}
+
+func (c *HistoryCommand) SetFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.Limit, "n", 20, "list the last n matching invocations, or all of them if 0")
+	fs.StringVar(&c.Command, "command", "", "list the invocations of this subcommand only")
+	fs.BoolVar(&c.Failed, "failed", false, "list the failed invocations only")
+	fs.StringVar(&c.Format, "format", "text", "output format: text or json")
+	fs.Int64Var(&c.Rerun, "rerun", 0, "run the invocation with this ID again, in its directory")
+	fs.BoolVar(&c.Yes, "yes", false, "rerun without asking for confirmation")
+}
+
+func (c *HistoryCommand) Execute(ctx *Context) error {
+	if len(ctx.Args) > 1 {
+		return errors.New("Usage: remote history [search]")
+	}
+	if c.Format != "text" && c.Format != "json" {
+		return fmt.Errorf("invalid format %q (want text or json)", c.Format)
+	}
+	records, err := auditLog(ctx.Config).Read()
+	if err != nil {
+		return err
+	}
+	if c.Rerun != 0 {
+		for _, rec := range records {
+			if rec.ID == c.Rerun {
+				return c.rerun(ctx, rec)
+			}
+		}
+		return fmt.Errorf("no invocation %d in the history", c.Rerun)
+	}
+
+	search := ""
+	if len(ctx.Args) == 1 {
+		search = ctx.Args[0]
+	}
+	var entries []audit.Record
+	for _, rec := range records {
+		if (c.Command != "" && rec.Command != c.Command) ||
+			(c.Failed && rec.ExitCode == 0) ||
+			(ctx.Config.Profile != "" && rec.Profile != ctx.Config.Profile) ||
+			(search != "" && !strings.Contains(rec.Host+" "+strings.Join(rec.Args, " "), search)) {
+			continue
+		}
+		entries = append(entries, rec)
+	}
+	if c.Limit > 0 && len(entries) > c.Limit {
+		entries = entries[len(entries)-c.Limit:]
+	}
+
+	if c.Format == "json" {
+		enc := json.NewEncoder(ctx.Stdout)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(ctx.Stdout, 0, 0, 2, ' ', 0)
+	for _, e := range entries {
+		host := e.Host
+		if e.Profile != "" {
+			host = fmt.Sprintf("%s (%s)", e.Host, e.Profile)
+		}
+		d := time.Duration(e.DurationMs) * time.Millisecond
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\tremote %s\n",
+			e.ID, e.Time.Local().Format("2006-01-02 15:04:05"), e.User, host, e.ExitCode, d.Round(10*time.Millisecond), shell.Join(e.Args))
+	}
+	return w.Flush()
+}
+
+// rerun runs the invocation of rec again in its directory, once the user
+// confirms unless c.Yes is set. The environment variables whose values were
+// redacted take their local values.
+func (c *HistoryCommand) rerun(ctx *Context, rec audit.Record) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := make([]string, len(rec.Args))
+	for i, arg := range rec.Args {
+		args[i] = strings.TrimSuffix(arg, "="+secretMask)
+	}
+	if st, err := os.Stat(rec.Dir); err != nil || !st.IsDir() {
+		return fmt.Errorf("directory of the invocation not found: %q", rec.Dir)
+	}
+	if c.Yes || ctx.DryRun != DryRunOff {
+		fmt.Fprintf(ctx.Stderr, "Running in %s: remote %s\n", rec.Dir, shell.Join(args))
+	} else {
+		ok, err := confirm(ctx, fmt.Sprintf("Run remote %s in %s again?", shell.Join(args), rec.Dir))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("rerun cancelled")
+		}
+	}
+	step := Step{Command: exe, Args: args, Dir: rec.Dir}
+	return executeStep(ctx, step, step)
+}
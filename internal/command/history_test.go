@@ -0,0 +1,116 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yhiraki/remote/internal/audit"
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func TestHistoryCommand_Execute(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.CacheDir = t.TempDir()
+	cfg.AuditLog.File = filepath.Join(cfg.CacheDir, "audit.log")
+	dir := t.TempDir()
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+	for i, rec := range []audit.Record{
+		{Host: "10.0.0.1", Command: "push", Args: []string{"push", "src"}},
+		{Host: "10.0.0.2", Profile: "gpu", Command: "sh", Args: []string{"--host", "gpu", "sh", "-e", "TOKEN=***", "make"}, ExitCode: 2},
+		{Host: "10.0.0.1", Command: "pull", Args: []string{"pull", "out.log"}},
+	} {
+		rec.Time = start.Add(time.Duration(i) * time.Minute)
+		rec.User = "alice"
+		rec.Dir = dir
+		if err := auditLog(cfg).Append(&rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		cmd     HistoryCommand
+		args    []string
+		profile string
+		wantIDs []string
+	}{
+		{name: "all", cmd: HistoryCommand{Limit: 20}, wantIDs: []string{"1", "2", "3"}},
+		{name: "last", cmd: HistoryCommand{Limit: 1}, wantIDs: []string{"3"}},
+		{name: "command", cmd: HistoryCommand{Command: "pull"}, wantIDs: []string{"3"}},
+		{name: "failed", cmd: HistoryCommand{Failed: true}, wantIDs: []string{"2"}},
+		{name: "profile", profile: "gpu", wantIDs: []string{"2"}},
+		{name: "search", args: []string{"src"}, wantIDs: []string{"1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *cfg
+			c.Profile = tt.profile
+			var stdout bytes.Buffer
+			ctx := NewContext(context.Background(), &c, nil, ".")
+			ctx.Args = tt.args
+			ctx.Stdout = &stdout
+			tt.cmd.Format = "text"
+			if err := tt.cmd.Execute(ctx); err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+				ids = append(ids, strings.Fields(line)[0])
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("listed %q, want %q\n%s", ids, tt.wantIDs, stdout.String())
+			}
+		})
+	}
+
+	var stdout bytes.Buffer
+	ctx := NewContext(context.Background(), cfg, nil, ".")
+	ctx.Stdout = &stdout
+	if err := (&HistoryCommand{Limit: 1, Format: "text"}).Execute(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := "3  2026-01-02 03:06:05  alice  10.0.0.1  0  0s  remote pull out.log\n"
+	if stdout.String() != want {
+		t.Errorf("output = %q, want %q", stdout.String(), want)
+	}
+
+	t.Run("rerun", func(t *testing.T) {
+		ctx := NewContext(context.Background(), cfg, nil, ".")
+		ctx.DryRun = DryRunText
+		ctx.Stderr = &bytes.Buffer{}
+		if err := (&HistoryCommand{Rerun: 2, Format: "text"}).Execute(ctx); err != nil {
+			t.Fatal(err)
+		}
+		exe, _ := os.Executable()
+		want := Step{Command: exe, Args: []string{"--host", "gpu", "sh", "-e", "TOKEN", "make"}, Env: []string{}, Dir: dir}
+		if steps := ctx.Steps(); len(steps) != 1 || !reflect.DeepEqual(steps[0], want) {
+			t.Errorf("steps = %+v, want %+v", steps, want)
+		}
+		if err := (&HistoryCommand{Rerun: 4, Format: "text"}).Execute(ctx); err == nil {
+			t.Error("Execute() expected error for an unknown invocation, got nil")
+		}
+	})
+
+	t.Run("rerun declined", func(t *testing.T) {
+		var stderr bytes.Buffer
+		ctx := NewContext(context.Background(), cfg, nil, ".")
+		ctx.Stdin = strings.NewReader("n\n")
+		ctx.Stderr = &stderr
+		err := (&HistoryCommand{Rerun: 2, Format: "text"}).Execute(ctx)
+		if err == nil || err.Error() != "rerun cancelled" {
+			t.Fatalf("Execute() error = %v, want rerun cancelled", err)
+		}
+		if len(ctx.Steps()) != 0 || !strings.Contains(stderr.String(), "Run remote --host gpu sh -e TOKEN make in ") {
+			t.Errorf("steps = %+v, prompt = %q", ctx.Steps(), stderr.String())
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package command
+
+import (
+	"os"
+	"time"
+
+	"github.com/yhiraki/remote/internal/hostkey"
+	"github.com/yhiraki/remote/internal/shell"
+)
+
+// sshOptions returns the ssh options verifying the host key of remoteHost
+// as the config says, pinning its keys first with the pinned policy unless
+// in dry-run mode, where nothing connects.
+func sshOptions(ctx *Context, remoteHost string) ([]string, error) {
+	return hostKeyOptions(ctx, remoteHost, ctx.DryRun == DryRunOff)
+}
+
+// hostKeyOptions is sshOptions pinning the keys with the pinned policy only
+// if pin is set.
+func hostKeyOptions(ctx *Context, remoteHost string, pin bool) ([]string, error) {
+	cfg := ctx.Config
+	if cfg == nil {
+		return nil, nil
+	}
+	policy, err := hostkey.Parse(cfg.HostKeyPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if policy == hostkey.Pinned && pin {
+		// refresh the keys with the hostname, as a new address is likely a new host
+		notBefore := time.Now().Add(-time.Duration(cfg.CacheExpireMinutes) * time.Minute)
+		if st, err := os.Stat(cfg.HostnameCacheFile()); err == nil && st.ModTime().After(notBefore) {
+			notBefore = st.ModTime()
+		}
+		if err := hostkey.Pin(ctx.Ctx, cfg.HostKeyCommand, remoteHost, cfg.KnownHostsFile(), cfg.HostKeyAlias(), notBefore); err != nil {
+			return nil, err
+		}
+	}
+	return hostkey.Options(policy, cfg.KnownHostsFile(), cfg.HostKeyAlias()), nil
+}
+
+// rsyncShellOptions returns the rsync options making it connect with
+// sshOptions, if any.
+func rsyncShellOptions(ctx *Context, remoteHost string) ([]string, error) {
+	opts, err := sshOptions(ctx, remoteHost)
+	if err != nil || len(opts) == 0 {
+		return nil, err
+	}
+	return []string{"-e", shell.Join(append([]string{"ssh"}, opts...))}, nil
+}
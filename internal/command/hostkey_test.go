@@ -0,0 +1,69 @@
+package command
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func TestHostKeyOptions(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{ConfigDir: dir, CacheDir: dir, HostKeyPolicy: "tofu", Profile: "gpu"}
+	knownHosts := filepath.Join(dir, "known_hosts-gpu")
+	want := []string{"-o", "UserKnownHostsFile=" + knownHosts, "-o", "StrictHostKeyChecking=accept-new", "-o", "HostKeyAlias=remote-gpu", "-o", "CheckHostIP=no"}
+	resolve := func() (string, error) { return "10.0.0.1", nil }
+
+	t.Run("ssh", func(t *testing.T) {
+		ctx := NewContext(context.Background(), cfg, resolve, "proj")
+		ctx.DryRun = DryRunText
+		if err := (&SSHCommand{}).Execute(ctx.withArgs([]string{"ls"})); err != nil {
+			t.Fatal(err)
+		}
+		got := ctx.Steps()[0].Args
+		if !reflect.DeepEqual(got[:len(want)], want) {
+			t.Errorf("ssh args = %q, want prefix %q", got, want)
+		}
+	})
+
+	t.Run("rsync", func(t *testing.T) {
+		ctx := NewContext(context.Background(), cfg, resolve, "proj")
+		ctx.DryRun = DryRunText
+		ctx.IsVerbose = true
+		if err := (&RsyncCommand{Direction: "pull"}).Execute(ctx.withArgs([]string{"app.log"})); err != nil {
+			t.Fatal(err)
+		}
+		got := strings.Join(ctx.Steps()[0].Args, "\n")
+		if !strings.Contains(got, "-e\nssh -o 'UserKnownHostsFile="+knownHosts+"' ") {
+			t.Errorf("rsync args = %q, want -e with the ssh options", ctx.Steps()[0].Args)
+		}
+	})
+
+	t.Run("pinned dry-run", func(t *testing.T) {
+		cfg := *cfg
+		cfg.HostKeyPolicy = "pinned"
+		cfg.HostKeyCommand = "false" // fails if run
+		ctx := NewContext(context.Background(), &cfg, resolve, "proj")
+		ctx.DryRun = DryRunText
+		if err := (&SSHCommand{}).Execute(ctx.withArgs([]string{"ls"})); err != nil {
+			t.Fatalf("Execute() error = %v, want the keys left unpinned", err)
+		}
+		ctx.DryRun = DryRunOff
+		if _, err := sshOptions(ctx, "10.0.0.1"); err == nil {
+			t.Error("sshOptions() expected the key command to run, got nil")
+		}
+	})
+
+	t.Run("invalid policy", func(t *testing.T) {
+		cfg := *cfg
+		cfg.HostKeyPolicy = "maybe"
+		ctx := NewContext(context.Background(), &cfg, resolve, "proj")
+		ctx.DryRun = DryRunText
+		if err := (&SSHCommand{}).Execute(ctx.withArgs([]string{"ls"})); err == nil {
+			t.Error("Execute() expected error for an invalid policy, got nil")
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package command
 
+import "flag"
+
 type Command interface {
+	// SetFlags registers the flags specific to the command.
+	SetFlags(fs *flag.FlagSet)
 	Execute(ctx *Context) error
 }
-
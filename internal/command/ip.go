@@ -1,11 +1,28 @@
 package command
 
-import "fmt"
+import (
+	"flag"
+	"fmt"
+)
+
+func init() {
+	Register(&Spec{
+		Name:     "ip",
+		Summary:  "Print the resolved remote hostname",
+		Examples: []string{"remote ip"},
+		New:      func() Command { return &IPCommand{} },
+	})
+}
 
 type IPCommand struct{}
 
+func (c *IPCommand) SetFlags(fs *flag.FlagSet) {}
+
 func (c *IPCommand) Execute(ctx *Context) error {
-	fmt.Println(ctx.RemoteHost)
+	h, err := ctx.RemoteHost()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(ctx.Stdout, h)
 	return nil
 }
-
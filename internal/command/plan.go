@@ -0,0 +1,110 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yhiraki/remote/internal/shell"
+)
+
+// DryRunMode selects whether commands are executed or only printed, and in which format.
+type DryRunMode string
+
+const (
+	DryRunOff   DryRunMode = ""
+	DryRunText  DryRunMode = "text"
+	DryRunJSON  DryRunMode = "json"
+	DryRunShell DryRunMode = "sh"
+)
+
+func (m *DryRunMode) String() string {
+	return string(*m)
+}
+
+// Set implements flag.Value. A bare --dry-run selects the text format.
+func (m *DryRunMode) Set(value string) error {
+	switch value {
+	case "true", "text":
+		*m = DryRunText
+	case "false":
+		*m = DryRunOff
+	case "json":
+		*m = DryRunJSON
+	case "sh":
+		*m = DryRunShell
+	default:
+		return fmt.Errorf("invalid dry-run format %q (want text, json or sh)", value)
+	}
+	return nil
+}
+
+func (m *DryRunMode) IsBoolFlag() bool {
+	return true
+}
+
+// Step is a single local process invocation. Env holds the variables set
+// for the command, locally or on the remote host, with their values masked
+// in plans.
+type Step struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Env     []string `json:"env"`
+	Dir     string   `json:"dir"`
+}
+
+// Plan collects the steps a subcommand would run in dry-run mode.
+type Plan struct {
+	Host         string `json:"host"`
+	ConfigSource string `json:"configSource"`
+	Steps        []Step `json:"steps"`
+}
+
+func (p *Plan) add(step Step) {
+	if step.Env == nil {
+		step.Env = []string{}
+	}
+	p.Steps = append(p.Steps, step)
+}
+
+// Write prints the plan to w in the given format.
+func (p *Plan) Write(w io.Writer, mode DryRunMode) error {
+	switch mode {
+	case DryRunJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	case DryRunShell:
+		return p.writeShell(w)
+	default:
+		for _, step := range p.Steps {
+			if _, err := fmt.Fprintln(w, append([]string{step.Command}, step.Args...)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (p *Plan) writeShell(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# host: %s\n", p.Host)
+	fmt.Fprintf(&b, "# config: %s\n", p.ConfigSource)
+	b.WriteString("set -e\n")
+	dir := ""
+	for _, step := range p.Steps {
+		if step.Dir != "" && step.Dir != dir {
+			fmt.Fprintf(&b, "cd %s\n", shell.Quote(step.Dir))
+			dir = step.Dir
+		}
+		if len(step.Env) > 0 {
+			fmt.Fprintf(&b, "env %s ", shell.Join(step.Env))
+		}
+		b.WriteString(shell.Join(append([]string{step.Command}, step.Args...)))
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
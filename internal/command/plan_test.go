@@ -0,0 +1,85 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDryRunMode_Set(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    DryRunMode
+		wantErr bool
+	}{
+		{value: "true", want: DryRunText},
+		{value: "text", want: DryRunText},
+		{value: "false", want: DryRunOff},
+		{value: "json", want: DryRunJSON},
+		{value: "sh", want: DryRunShell},
+		{value: "yaml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var m DryRunMode
+			err := m.Set(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DryRunMode.Set() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && m != tt.want {
+				t.Errorf("DryRunMode.Set() = %v, want %v", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlan_Write(t *testing.T) {
+	p := &Plan{Host: "example.com", ConfigSource: "/home/user/.remoterc.json"}
+	p.add(Step{Command: "rsync", Args: []string{"-av", "my file", "example.com:my file"}, Dir: "/home/user/src"})
+	p.add(Step{Command: "ssh", Args: []string{"example.com", "-t", "cd 'src'; exec $SHELL"}, Env: []string{"FOO=bar baz"}, Dir: "/home/user/src"})
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := p.Write(&buf, DryRunText); err != nil {
+			t.Fatal(err)
+		}
+		want := "[rsync -av my file example.com:my file]\n[ssh example.com -t cd 'src'; exec $SHELL]\n"
+		if buf.String() != want {
+			t.Errorf("Plan.Write() = %q, want %q", buf.String(), want)
+		}
+	})
+
+	t.Run("sh", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := p.Write(&buf, DryRunShell); err != nil {
+			t.Fatal(err)
+		}
+		want := "#!/bin/sh\n" +
+			"# host: example.com\n" +
+			"# config: /home/user/.remoterc.json\n" +
+			"set -e\n" +
+			"cd /home/user/src\n" +
+			"rsync -av 'my file' 'example.com:my file'\n" +
+			"env 'FOO=bar baz' ssh example.com -t 'cd '\\''src'\\''; exec $SHELL'\n"
+		if buf.String() != want {
+			t.Errorf("Plan.Write() = %q, want %q", buf.String(), want)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := p.Write(&buf, DryRunJSON); err != nil {
+			t.Fatal(err)
+		}
+		var got Plan
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(&got, p) {
+			t.Errorf("Plan.Write() round trip = %+v, want %+v", got, p)
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+// pluginPrefix is the prefix of executables providing plugin subcommands.
+const pluginPrefix = "remote-"
+
+// pluginContextFd is the file descriptor on which plugins receive their context as JSON.
+const pluginContextFd = 3
+
+func init() {
+	Register(&Spec{
+		Name:     "plugin",
+		Usage:    "list",
+		Summary:  "List plugin commands found in the plugins directory, and optionally on PATH",
+		Examples: []string{"remote plugin list", "remote plugin list --path"},
+		NoAudit:  true,
+		New:      func() Command { return &PluginsCommand{} },
+	})
+}
+
+// PluginContext is the resolved context passed to plugins.
+type PluginContext struct {
+	Host         string   `json:"host"`
+	HostProfile  string   `json:"hostProfile"`
+	CwdRel       string   `json:"cwdRel"`
+	ExcludeFiles []string `json:"excludeFiles"`
+	DryRun       string   `json:"dryRun"`
+	Verbose      bool     `json:"verbose"`
+	ConfigFile   string   `json:"configFile"`
+	ConfigDir    string   `json:"configDir"`
+	CacheDir     string   `json:"cacheDir"`
+	Args         []string `json:"args"`
+}
+
+// env returns the context as environment variables.
+func (p *PluginContext) env() []string {
+	verbose := ""
+	if p.Verbose {
+		verbose = "1"
+	}
+	return []string{
+		"REMOTE_HOST=" + p.Host,
+		"REMOTE_HOST_PROFILE=" + p.HostProfile,
+		"REMOTE_CWD_REL=" + p.CwdRel,
+		"REMOTE_EXCLUDE_FILES=" + strings.Join(p.ExcludeFiles, "\n"),
+		"REMOTE_DRY_RUN=" + p.DryRun,
+		"REMOTE_VERBOSE=" + verbose,
+		"REMOTE_CONFIG_FILE=" + p.ConfigFile,
+		"REMOTE_CONFIG_DIR=" + p.ConfigDir,
+		"REMOTE_CACHE_DIR=" + p.CacheDir,
+		"REMOTE_CONTEXT_FD=" + strconv.Itoa(pluginContextFd),
+	}
+}
+
+// pluginSpec returns a spec running the plugin executable for name.
+func pluginSpec(name string, cfg *config.Config) (*Spec, bool) {
+	path, ok := findPlugin(name, cfg)
+	if !ok {
+		return nil, false
+	}
+	return &Spec{
+		Name:    name,
+		Usage:   "[args...]",
+		Summary: "Plugin " + path,
+		RawArgs: true,
+		New:     func() Command { return &PluginCommand{Name: name, Path: path} },
+	}, true
+}
+
+// findPlugin returns the plugin executable for name, from the plugins
+// directory under ConfigDir or else from PATH.
+func findPlugin(name string, cfg *config.Config) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	if cfg != nil {
+		path := filepath.Join(pluginsDir(cfg), pluginPrefix+name)
+		if isExecutable(path) {
+			return path, true
+		}
+	}
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// listPlugins returns the plugin executables of the plugins directory by
+// command name, followed by those on PATH if onPath is set. Executables on
+// PATH are only listed on request, as unrelated programs such as
+// remote-viewer share the prefix.
+func listPlugins(cfg *config.Config, onPath bool) map[string]string {
+	var dirs []string
+	if cfg != nil {
+		dirs = append(dirs, pluginsDir(cfg))
+	}
+	if onPath {
+		dirs = append(dirs, filepath.SplitList(os.Getenv("PATH"))...)
+	}
+	plugins := map[string]string{}
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name := strings.TrimPrefix(e.Name(), pluginPrefix)
+			if name == e.Name() || name == "" {
+				continue
+			}
+			if _, ok := plugins[name]; ok {
+				continue
+			}
+			if path := filepath.Join(dir, e.Name()); isExecutable(path) {
+				plugins[name] = path
+			}
+		}
+	}
+	return plugins
+}
+
+func pluginsDir(cfg *config.Config) string {
+	return filepath.Join(cfg.ConfigDir, "plugins")
+}
+
+func isExecutable(path string) bool {
+	st, err := os.Stat(path)
+	return err == nil && st.Mode().IsRegular() && st.Mode()&0o111 != 0
+}
+
+// PluginCommand runs an external remote-<name> executable.
+type PluginCommand struct {
+	Name string
+	Path string
+}
+
+func (c *PluginCommand) SetFlags(fs *flag.FlagSet) {}
+
+func (c *PluginCommand) Execute(ctx *Context) error {
+	remoteHost, err := ctx.RemoteHost()
+	if err != nil {
+		return err
+	}
+	pctx := &PluginContext{
+		Host:         remoteHost,
+		HostProfile:  ctx.Config.Profile,
+		CwdRel:       ctx.CwdRel,
+		ExcludeFiles: ctx.Config.ExcludeFiles,
+		DryRun:       string(ctx.DryRun),
+		Verbose:      ctx.IsVerbose,
+		ConfigFile:   ctx.Config.Source,
+		ConfigDir:    ctx.Config.ConfigDir,
+		CacheDir:     ctx.Config.CacheDir,
+		Args:         ctx.Args,
+	}
+	payload, err := json.Marshal(pctx)
+	if err != nil {
+		return err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	go func() {
+		w.Write(payload)
+		w.Close()
+	}()
+
+	cmd := exec.CommandContext(ctx.Ctx, c.Path, ctx.Args...)
+	cmd.Stdin = ctx.Stdin
+	cmd.Stdout = ctx.Stdout
+	cmd.Stderr = ctx.Stderr
+	cmd.Env = append(os.Environ(), pctx.env()...)
+	cmd.ExtraFiles = []*os.File{r} // becomes pluginContextFd in the child
+	return runProcess(cmd)
+}
+
+type PluginsCommand struct {
+	OnPath bool
+}
+
+func (c *PluginsCommand) SetFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.OnPath, "path", false, "also list the remote-* executables found on PATH")
+}
+
+func (c *PluginsCommand) Execute(ctx *Context) error {
+	if len(ctx.Args) != 1 || ctx.Args[0] != "list" {
+		return errors.New("Usage: remote plugin list")
+	}
+	plugins := listPlugins(ctx.Config, c.OnPath)
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(ctx.Stdout, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		note := ""
+		if _, ok := registry[name]; ok {
+			note = "(shadowed by built-in command)"
+		} else if _, ok := taskSpec(name, ctx.Config); ok {
+			note = "(shadowed by task)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, plugins[name], note)
+	}
+	return w.Flush()
+}
+
+func (c *PluginsCommand) Complete(ctx *Context, args []string, toComplete string) []string {
+	if len(args) > 0 {
+		return nil
+	}
+	return []string{"list"}
+}
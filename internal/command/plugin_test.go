@@ -0,0 +1,122 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func TestPluginCommand(t *testing.T) {
+	tmpDir := t.TempDir()
+	pluginDir := filepath.Join(tmpDir, "plugins")
+	if err := os.MkdirAll(pluginDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\n{ echo \"$REMOTE_HOST|$REMOTE_CWD_REL|$REMOTE_DRY_RUN|$*\"; cat <&3; } > \"$PLUGIN_OUT\"\n"
+	if err := os.WriteFile(filepath.Join(pluginDir, "remote-hello"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// not executable, so not a plugin
+	if err := os.WriteFile(filepath.Join(pluginDir, "remote-readme"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(tmpDir, "out")
+	t.Setenv("PLUGIN_OUT", out)
+
+	cfg := &config.Config{ConfigDir: tmpDir, CacheDir: tmpDir, ExcludeFiles: []string{".git"}}
+
+	plugins := listPlugins(cfg, false)
+	if got := plugins["hello"]; got != filepath.Join(pluginDir, "remote-hello") {
+		t.Errorf("listPlugins()[hello] = %v", got)
+	}
+	if _, ok := plugins["readme"]; ok {
+		t.Error("listPlugins() includes a non-executable file")
+	}
+
+	inv, err := Parse([]string{"hello", "--dry-run=json", "-x", "world"}, cfg)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, ok := inv.Command.(*PluginCommand); !ok {
+		t.Fatalf("Parse() command = %T, want *PluginCommand", inv.Command)
+	}
+	err = inv.Run(context.Background(), cfg, func() (string, error) { return "example.com", nil }, "src")
+	if err != nil {
+		t.Fatalf("Invocation.Run() error = %v", err)
+	}
+
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(content), "\n", 2)
+	if lines[0] != "example.com|src|json|-x world" {
+		t.Errorf("plugin environment = %q", lines[0])
+	}
+	var pctx PluginContext
+	if err := json.Unmarshal([]byte(lines[1]), &pctx); err != nil {
+		t.Fatalf("plugin context %q: %v", lines[1], err)
+	}
+	want := PluginContext{
+		Host:         "example.com",
+		CwdRel:       "src",
+		ExcludeFiles: []string{".git"},
+		DryRun:       "json",
+		ConfigDir:    tmpDir,
+		CacheDir:     tmpDir,
+		Args:         []string{"-x", "world"},
+	}
+	if !reflect.DeepEqual(pctx, want) {
+		t.Errorf("plugin context = %+v, want %+v", pctx, want)
+	}
+}
+
+func TestFindPlugin(t *testing.T) {
+	cfgDir := t.TempDir()
+	pluginDir := filepath.Join(cfgDir, "plugins")
+	binDir := t.TempDir()
+	for _, path := range []string{
+		filepath.Join(pluginDir, "remote-hello"),
+		filepath.Join(binDir, "remote-hello"),
+		filepath.Join(binDir, "remote-viewer"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", binDir)
+	cfg := &config.Config{ConfigDir: cfgDir}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"hello", filepath.Join(pluginDir, "remote-hello")},
+		{"viewer", filepath.Join(binDir, "remote-viewer")},
+		{"missing", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got, _ := findPlugin(tt.name, cfg); got != tt.want {
+			t.Errorf("findPlugin(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// unrelated remote-* executables on PATH are only listed on request
+	if _, ok := listPlugins(cfg, false)["viewer"]; ok {
+		t.Error("listPlugins(cfg, false) includes an executable on PATH")
+	}
+	if got := listPlugins(cfg, true)["viewer"]; got != filepath.Join(binDir, "remote-viewer") {
+		t.Errorf("listPlugins(cfg, true)[viewer] = %q", got)
+	}
+}
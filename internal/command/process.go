@@ -0,0 +1,49 @@
+package command
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+)
+
+// terminateDelay is how long a process may take to exit after being asked
+// to terminate on cancellation, before it is killed.
+const terminateDelay = 10 * time.Second
+
+// runProcess runs cmd, relaying the signals received by remote to it.
+// When ctx is cancelled the process is asked to terminate so that it can
+// clean up, such as rsync removing partially transferred files.
+func runProcess(cmd *exec.Cmd) error {
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(terminateSignal)
+	}
+	cmd.WaitDelay = terminateDelay
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	stop := forwardSignals(cmd.Process)
+	defer stop()
+	return cmd.Wait()
+}
+
+// forwardSignals relays forwardedSignals to p until stop is called.
+func forwardSignals(p *os.Process) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, forwardedSignals...)
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				p.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
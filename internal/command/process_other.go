@@ -0,0 +1,9 @@
+//go:build !unix
+
+package command
+
+import "os"
+
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+var terminateSignal os.Signal = os.Kill
@@ -0,0 +1,15 @@
+//go:build unix
+
+package command
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are relayed to running processes. Processes in the
+// foreground process group of a terminal receive them from the terminal as
+// well; ssh and rsync handle the duplicates gracefully.
+var forwardedSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGWINCH}
+
+var terminateSignal os.Signal = syscall.SIGTERM
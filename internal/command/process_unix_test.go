@@ -0,0 +1,78 @@
+//go:build unix
+
+package command
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunProcess_cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", `trap 'echo terminated; exit 0' TERM; echo ready; while :; do sleep 0.05; done`)
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+	cmd.Stdout = pw
+	done := make(chan error, 1)
+	go func() { done <- runProcess(cmd) }()
+
+	r := bufio.NewReader(pr)
+	if line, _ := r.ReadString('\n'); line != "ready\n" {
+		t.Fatalf("child output = %q, want ready", line)
+	}
+	cancel()
+
+	// the child is asked to terminate instead of being killed
+	if line, _ := r.ReadString('\n'); line != "terminated\n" {
+		t.Errorf("child output = %q, want terminated", line)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("process did not exit after cancellation")
+	}
+}
+
+func TestForwardSignals(t *testing.T) {
+	cmd := exec.Command("sh", "-c", `trap 'echo winch; exit 0' WINCH; echo ready; while :; do sleep 0.05; done`)
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	defer pw.Close()
+	cmd.Stdout = pw
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	stop := forwardSignals(cmd.Process)
+	defer stop()
+
+	r := bufio.NewReader(pr)
+	if line, _ := r.ReadString('\n'); line != "ready\n" {
+		t.Fatalf("child output = %q, want ready", line)
+	}
+	// SIGWINCH is ignored by default, so sending it to the test process is safe.
+	if err := syscall.Kill(os.Getpid(), syscall.SIGWINCH); err != nil {
+		t.Fatal(err)
+	}
+	line, _ := r.ReadString('\n')
+	if strings.TrimSpace(line) != "winch" {
+		t.Errorf("child output = %q, want winch", line)
+	}
+	cmd.Wait()
+}
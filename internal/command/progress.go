@@ -0,0 +1,116 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yhiraki/remote/internal/rsync"
+	"github.com/yhiraki/remote/internal/term"
+)
+
+// progressArgs make rsync report changes and overall progress instead of
+// listing every file, for parsing by executeWithProgress.
+var progressArgs = []string{"-a", "--itemize-changes", "--info=progress2", "--stats"}
+
+const progressBarWidth = 30
+
+// rsyncHasProgress reports whether the local rsync supports progressArgs:
+// --info=progress2 appeared in rsync 3.1, while macOS ships 2.6.9, or
+// openrsync claiming compatibility with it. The version is detected once.
+var rsyncHasProgress = sync.OnceValue(func() bool {
+	out, err := exec.Command("rsync", "--version").Output()
+	if err != nil {
+		// running rsync reports the error
+		return true
+	}
+	major, minor, ok := parseRsyncVersion(string(out))
+	return !ok || major > 3 || major == 3 && minor >= 1
+})
+
+var rsyncVersionPattern = regexp.MustCompile(`rsync\s+version\s+v?(\d+)\.(\d+)`)
+
+// parseRsyncVersion finds the version in the output of rsync --version.
+func parseRsyncVersion(s string) (major, minor int, ok bool) {
+	m := rsyncVersionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, false
+	}
+	major, _ = strconv.Atoi(m[1])
+	minor, _ = strconv.Atoi(m[2])
+	return major, minor, true
+}
+
+// executeWithProgress runs rsync with its output parsed into a progress bar
+// on stderr, when it is a terminal, and prints a summary of the transfer.
+func executeWithProgress(ctx *Context, name string, args []string) error {
+	start := time.Now()
+	bar := &progressBar{w: ctx.Stderr}
+	if f, ok := ctx.Stderr.(*os.File); !ok || !term.IsTerminal(f) {
+		bar.w = nil
+	}
+	p := &rsync.Parser{OnProgress: bar.update}
+	pctx := *ctx
+	pctx.Stdout = p
+	err := executeSubCommand(&pctx, name, args)
+	p.Close()
+	bar.clear()
+	ctx.addTransferred(p.Stats)
+	if err != nil || ctx.DryRun != DryRunOff {
+		return err
+	}
+	fmt.Fprintln(ctx.Stdout, formatSummary(p.Stats, time.Since(start)))
+	return nil
+}
+
+// progressBar redraws a single line on w. A nil w draws nothing.
+type progressBar struct {
+	w     io.Writer
+	drawn bool
+}
+
+func (b *progressBar) update(p rsync.Progress) {
+	if b.w == nil {
+		return
+	}
+	filled := p.Percent * progressBarWidth / 100
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	fmt.Fprintf(b.w, "\r\033[K[%s%s] %3d%% %9s %12s ETA %s",
+		strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled),
+		p.Percent, formatBytes(p.Bytes), p.Rate, p.ETA)
+	b.drawn = true
+}
+
+func (b *progressBar) clear() {
+	if b.drawn {
+		fmt.Fprint(b.w, "\r\033[K")
+	}
+}
+
+// formatSummary describes a finished transfer in one line.
+func formatSummary(s rsync.Stats, d time.Duration) string {
+	return fmt.Sprintf("%d added, %d updated, %d deleted, %s sent, %s received in %s",
+		s.Added, s.Updated, s.Deleted, formatBytes(s.BytesSent), formatBytes(s.BytesReceived), d.Round(10*time.Millisecond))
+}
+
+// formatBytes formats n in bytes with a binary unit prefix.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,80 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecuteWithProgress(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\n" +
+		`printf '>f+++++++++ a.txt\n      1,024  50%%    1.00MB/s    0:00:01\r'` + "\n" +
+		`printf '>f.st...... b.txt\n      2,048 100%%    1.00MB/s    0:00:00 (xfr#2, to-chk=0/3)\n'` + "\n" +
+		`printf '\nTotal bytes sent: 2,148\nTotal bytes received: 35\n'` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "rsync"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var stdout, stderr bytes.Buffer
+	ctx := NewContext(context.Background(), nil, nil, ".")
+	ctx.Stdout = &stdout
+	ctx.Stderr = &stderr
+	if err := executeWithProgress(ctx, "rsync", progressArgs); err != nil {
+		t.Fatal(err)
+	}
+	want := "1 added, 1 updated, 0 deleted, 2.1KiB sent, 35B received in "
+	if !strings.HasPrefix(stdout.String(), want) {
+		t.Errorf("stdout = %q, want prefix %q", stdout.String(), want)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("stderr = %q, want no progress bar when not a terminal", stderr.String())
+	}
+	if ctx.transferred.BytesSent != 2148 || ctx.transferred.BytesReceived != 35 {
+		t.Errorf("transferred = %+v, want the bytes of the stats", *ctx.transferred)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{n: 0, want: "0B"},
+		{n: 1023, want: "1023B"},
+		{n: 1024, want: "1.0KiB"},
+		{n: 1536, want: "1.5KiB"},
+		{n: 5 << 30, want: "5.0GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestParseRsyncVersion(t *testing.T) {
+	tests := []struct {
+		out          string
+		major, minor int
+		ok           bool
+	}{
+		{"rsync  version 3.2.7  protocol version 31\nCopyright (C) 1996-2022 by Andrew Tridgell, Wayne Davison, and others.\n", 3, 2, true},
+		{"rsync  version v3.2.3  protocol version 31\n", 3, 2, true},
+		{"rsync  version 2.6.9  protocol version 29\n", 2, 6, true},
+		// openrsync of macOS
+		{"openrsync: protocol version 29\nrsync version 2.6.9 compatible\n", 2, 6, true},
+		{"usage: rsync\n", 0, 0, false},
+	}
+	for _, tt := range tests {
+		major, minor, ok := parseRsyncVersion(tt.out)
+		if major != tt.major || minor != tt.minor || ok != tt.ok {
+			t.Errorf("parseRsyncVersion(%q) = %d, %d, %v, want %d, %d, %v", tt.out, major, minor, ok, tt.major, tt.minor, tt.ok)
+		}
+	}
+}
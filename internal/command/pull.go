@@ -0,0 +1,141 @@
+package command
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/yhiraki/remote/internal/rsync"
+)
+
+// PullStrategy decides what pull does with local files that already exist.
+type PullStrategy int
+
+const (
+	// PullIgnoreExisting keeps existing local files.
+	PullIgnoreExisting PullStrategy = iota
+	// PullUpdate replaces local files older than the remote ones.
+	PullUpdate
+	// PullOverwrite replaces local files that differ.
+	PullOverwrite
+	// PullBackup replaces local files that differ, keeping the local version
+	// with a timestamped suffix.
+	PullBackup
+)
+
+func (s PullStrategy) String() string {
+	switch s {
+	case PullUpdate:
+		return "update"
+	case PullOverwrite:
+		return "overwrite"
+	case PullBackup:
+		return "backup"
+	default:
+		return "ignore-existing"
+	}
+}
+
+// SetFlags registers a flag selecting each strategy; the last one given wins.
+func (s *PullStrategy) SetFlags(fs *flag.FlagSet) {
+	fs.Var(PullStrategyFlag{Strategy: s, Value: PullIgnoreExisting}, "ignore-existing", "keep existing local files (default)")
+	fs.Var(PullStrategyFlag{Strategy: s, Value: PullUpdate}, "update", "replace local files only when the remote file is newer")
+	fs.Var(PullStrategyFlag{Strategy: s, Value: PullOverwrite}, "overwrite", "replace local files that differ")
+	fs.Var(PullStrategyFlag{Strategy: s, Value: PullBackup}, "backup", "replace local files that differ, keeping the local version with a timestamped suffix")
+}
+
+// args returns the rsync options implementing s.
+func (s PullStrategy) args(backupSuffix string) []string {
+	switch s {
+	case PullUpdate:
+		return []string{"--update"}
+	case PullOverwrite:
+		return nil
+	case PullBackup:
+		return []string{"--backup", "--suffix", backupSuffix}
+	default:
+		return []string{"--ignore-existing"}
+	}
+}
+
+// backupSuffix returns the suffix of files backed up by a pull started at t.
+func backupSuffix(t time.Time) string {
+	return t.Format(".20060102-150405~")
+}
+
+// PullStrategyFlag is a boolean flag.Value that sets Strategy to Value when given.
+type PullStrategyFlag struct {
+	Strategy *PullStrategy
+	Value    PullStrategy
+}
+
+func (f PullStrategyFlag) String() string {
+	return strconv.FormatBool(f.Strategy != nil && *f.Strategy == f.Value)
+}
+
+func (f PullStrategyFlag) Set(value string) error {
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	if on {
+		*f.Strategy = f.Value
+	} else if *f.Strategy == f.Value {
+		*f.Strategy = PullIgnoreExisting
+	}
+	return nil
+}
+
+func (f PullStrategyFlag) IsBoolFlag() bool {
+	return true
+}
+
+// confirmDiff lists the files that differ between the remote and local
+// copies and asks the user to confirm the pull, unless c.Yes is set.
+func (c *RsyncCommand) confirmDiff(ctx *Context, remoteHost string) error {
+	// compare every file, whatever the strategy would skip
+	preview := *c
+	preview.Strategy = PullOverwrite
+	preview.Progress = false
+	name, args, err := preview.build(remoteHost, ctx.Args, transferExcludes(ctx, "."), ctx.CwdRel)
+	if err != nil {
+		return err
+	}
+	changes, err := previewChanges(ctx, name, args)
+	if err != nil {
+		return fmt.Errorf("failed to compare files: %w", err)
+	}
+	var n int
+	for _, ch := range changes {
+		if ch.IsDir || ch.Kind == rsync.Unchanged {
+			continue
+		}
+		if n == 0 {
+			fmt.Fprintf(ctx.Stderr, "Files that differ on %s:\n", remoteHost)
+		}
+		n++
+		status := "changed"
+		if ch.Kind == rsync.Added {
+			status = "new"
+		}
+		fmt.Fprintf(ctx.Stderr, "  %-8s %s\n", status, ch.Path)
+	}
+	if n == 0 {
+		fmt.Fprintln(ctx.Stderr, "No files differ.")
+		return nil
+	}
+	fmt.Fprintf(ctx.Stderr, "Existing local files are handled with --%s.\n", c.Strategy)
+	if c.Yes {
+		return nil
+	}
+	ok, err := confirm(ctx, "Pull these files?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("pull cancelled")
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func TestPullStrategy_SetFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		want PullStrategy
+	}{
+		{args: []string{}, want: PullIgnoreExisting},
+		{args: []string{"--update"}, want: PullUpdate},
+		{args: []string{"--overwrite"}, want: PullOverwrite},
+		{args: []string{"--backup"}, want: PullBackup},
+		{args: []string{"--backup", "--ignore-existing"}, want: PullIgnoreExisting},
+	}
+
+	for _, tt := range tests {
+		var s PullStrategy
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		s.SetFlags(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if s != tt.want {
+			t.Errorf("%v: PullStrategy = %v, want %v", tt.args, s, tt.want)
+		}
+	}
+}
+
+func TestRsyncCommand_buildPull(t *testing.T) {
+	tests := []struct {
+		strategy PullStrategy
+		want     []string
+	}{
+		{strategy: PullIgnoreExisting, want: []string{"-av", "--ignore-existing", "example.com:src/app.log", "app.log"}},
+		{strategy: PullUpdate, want: []string{"-av", "--update", "example.com:src/app.log", "app.log"}},
+		{strategy: PullOverwrite, want: []string{"-av", "example.com:src/app.log", "app.log"}},
+		{strategy: PullBackup, want: []string{"-av", "--backup", "--suffix", ".20261019-150405~", "example.com:src/app.log", "app.log"}},
+	}
+
+	for _, tt := range tests {
+		c := &RsyncCommand{Direction: "pull", Strategy: tt.strategy, backupSuffix: backupSuffix(time.Date(2026, 10, 19, 15, 4, 5, 0, time.UTC))}
+		_, got, err := c.build("example.com", []string{"app.log"}, nil, "src")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: RsyncCommand.build() args = %q, want %q", tt.strategy, got, tt.want)
+		}
+	}
+}
+
+func TestRsyncCommand_confirmDiff(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho \"$@\" > \"$(dirname \"$0\")/args\"\n" +
+		"printf 'cd+++++++++ logs/\\n>f+++++++++ logs/new.log\\n>f.st...... app.log\\n.f....og... same.log\\n'\n"
+	if err := os.WriteFile(filepath.Join(bin, "rsync"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var stderr bytes.Buffer
+	ctx := NewContext(context.Background(), &config.Config{}, nil, "src")
+	ctx.Args = []string{"logs"}
+	ctx.Stdin = strings.NewReader("y\n")
+	ctx.Stderr = &stderr
+	c := &RsyncCommand{Direction: "pull", Strategy: PullUpdate}
+	if err := c.confirmDiff(ctx, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	want := "Files that differ on example.com:\n" +
+		"  new      logs/new.log\n" +
+		"  changed  app.log\n" +
+		"Existing local files are handled with --update.\n" +
+		"Pull these files? [y/N] "
+	if stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+	args, err := os.ReadFile(filepath.Join(bin, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(args), "--update") {
+		t.Errorf("preview args = %q, want every differing file compared", args)
+	}
+}
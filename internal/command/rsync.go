@@ -1,29 +1,224 @@
 package command
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yhiraki/remote/internal/rsync"
+	"github.com/yhiraki/remote/internal/term"
 )
 
+func init() {
+	Register(&Spec{
+		Name:         "push",
+		Usage:        "<path>... [:dest]",
+		Summary:      "Transfer local files or directories to the same relative paths on the remote host",
+		Examples:     []string{"remote push .", "remote push src/main.go", "remote push a.py b.py", "remote push app.conf :/etc/app/", "remote push --mirror --yes .", "remote push . -- --compress --checksum", "remote push --bwlimit 1m --no-wait data/"},
+		Interspersed: true,
+		Passthrough:  true,
+		New:          func() Command { return &RsyncCommand{Direction: "push"} },
+	})
+	Register(&Spec{
+		Name:         "pull",
+		Usage:        "<path|glob>... | :<path|glob>... [dest]",
+		Summary:      "Download files or directories from the same relative paths on the remote host",
+		Examples:     []string{"remote pull build/app.log", "remote pull 'logs/*.log'", "remote pull :/var/log/app.log tmp/", "remote pull --backup --diff build/"},
+		Interspersed: true,
+		Passthrough:  true,
+		New:          func() Command { return &RsyncCommand{Direction: "pull"} },
+	})
+}
+
 type RsyncCommand struct {
 	Direction string // "push" or "pull"
+	Progress  bool   // report progress and a summary instead of listing files
+	Mirror    bool   // delete remote files missing locally
+	Yes       bool   // proceed without asking for confirmation
+	Protect   []string
+	Strategy  PullStrategy
+	Diff      bool     // list the files that differ before pulling
+	Options   []string // rsync options following those built
+	Transfer  TransferOptions
+
+	backupSuffix string
+}
+
+func (c *RsyncCommand) SetFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.Yes, "yes", false, "do not ask for confirmation")
+	c.Transfer.SetFlags(fs)
+	if c.Direction == "pull" {
+		c.Strategy.SetFlags(fs)
+		fs.BoolVar(&c.Diff, "diff", false, "list the files that differ and ask before pulling")
+		return
+	}
+	fs.BoolVar(&c.Mirror, "mirror", c.Mirror, "delete remote files that do not exist locally (excluded and protected paths are kept)")
 }
 
 func (c *RsyncCommand) Execute(ctx *Context) error {
-	cmdName, cmdArgs, err := c.build(ctx.RemoteHost, ctx.Args, ctx.Config.ExcludeFiles, ctx.CwdRel)
+	remoteHost, err := ctx.RemoteHost()
+	if err != nil {
+		return err
+	}
+	c.Progress = !ctx.IsVerbose && rsyncHasProgress()
+	if c.Direction == "push" {
+		c.Mirror = c.Mirror || ctx.Config.Mirror
+		c.Protect = ctx.Config.ProtectPaths
+	}
+	opts, err := rsyncOptions(ctx, c.Direction, append(c.Options, ctx.Passthrough...))
+	if err != nil {
+		return err
+	}
+	shellOpts, err := rsyncShellOptions(ctx, remoteHost)
+	if err != nil {
+		return err
+	}
+	c.Options = append(append(shellOpts, c.Transfer.args(ctx.Config)...), opts...)
+	if c.Strategy == PullBackup {
+		c.backupSuffix = backupSuffix(time.Now())
+	}
+	cmdName, cmdArgs, err := c.build(remoteHost, ctx.Args, transferExcludes(ctx, "."), ctx.CwdRel)
+	if err != nil {
+		return err
+	}
+	if ctx.DryRun == DryRunOff {
+		if c.Mirror {
+			err = c.confirmDeletions(ctx, remoteHost, cmdName, cmdArgs)
+		} else if c.Diff && c.Direction == "pull" {
+			err = c.confirmDiff(ctx, remoteHost)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// not held while the user answers, which would hold up other transfers
+	unlock, err := c.Transfer.lock(ctx)
 	if err != nil {
 		return err
 	}
-	return executeSubCommand(cmdName, cmdArgs, ctx.IsDryRun)
+	defer unlock()
+	if c.Progress {
+		return executeWithProgress(ctx, cmdName, cmdArgs)
+	}
+	return executeSubCommand(ctx, cmdName, cmdArgs)
+}
+
+func (c *RsyncCommand) Complete(ctx *Context, args []string, toComplete string) []string {
+	if c.Direction == "pull" {
+		return completeRemotePath(ctx, toComplete)
+	}
+	return completeLocalPath(toComplete)
+}
+
+// confirmDeletions previews the files a mirroring transfer deletes on the
+// remote host and asks the user to confirm, unless c.Yes is set.
+func (c *RsyncCommand) confirmDeletions(ctx *Context, remoteHost, name string, args []string) error {
+	deletions, err := previewDeletions(ctx, name, args)
+	if err != nil {
+		return fmt.Errorf("failed to preview deletions: %w", err)
+	}
+	if len(deletions) == 0 {
+		return nil
+	}
+	fmt.Fprintf(ctx.Stderr, "The following %d files will be deleted on %s:\n", len(deletions), remoteHost)
+	for _, path := range deletions {
+		fmt.Fprintf(ctx.Stderr, "  %s\n", path)
+	}
+	if c.Yes {
+		return nil
+	}
+	ok, err := confirm(ctx, "Delete these files?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("push cancelled")
+	}
+	return nil
+}
+
+// previewDeletions runs rsync with args in dry-run mode and returns the paths
+// it would delete, read from the "*deleting" lines only. The other lines,
+// such as the file list and the statistics of -v, are not deletions whatever
+// they look like.
+func previewDeletions(ctx *Context, name string, args []string) ([]string, error) {
+	var out bytes.Buffer
+	pctx := *ctx
+	pctx.Stdin = nil // keep the answer to the prompt
+	pctx.Stdout = &out
+	err := executeSubCommand(&pctx, name, append([]string{"--dry-run", "--itemize-changes"}, args...))
+	var deletions []string
+	for _, line := range strings.FieldsFunc(out.String(), func(r rune) bool { return r == '\n' || r == '\r' }) {
+		if path, ok := rsync.ParseDeletion(line); ok {
+			deletions = append(deletions, path)
+		}
+	}
+	return deletions, err
+}
+
+// previewChanges runs rsync with args in dry-run mode and returns the
+// itemized changes it would make.
+func previewChanges(ctx *Context, name string, args []string) ([]rsync.Change, error) {
+	var changes []rsync.Change
+	p := &rsync.Parser{OnChange: func(ch rsync.Change) {
+		changes = append(changes, ch)
+	}}
+	pctx := *ctx
+	pctx.Stdin = nil // keep the answer to the prompt
+	pctx.Stdout = p
+	err := executeSubCommand(&pctx, name, append([]string{"--dry-run", "--itemize-changes"}, args...))
+	p.Close()
+	return changes, err
+}
+
+// confirm asks a yes/no question on stderr and reads the answer from stdin.
+// Without stdin, as in a Client with no Stdin, or with a file other than a
+// terminal there is nobody to answer.
+func confirm(ctx *Context, question string) (bool, error) {
+	f, isFile := ctx.Stdin.(*os.File)
+	if ctx.Stdin == nil || isFile && (f == nil || !term.IsTerminal(f)) {
+		return false, errors.New("confirmation needs a terminal; use --yes to proceed anyway")
+	}
+	fmt.Fprintf(ctx.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(ctx.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
 }
 
 func (c *RsyncCommand) build(remoteHost string, subCmdArgs, excludeFiles []string, cwdRel string) (string, []string, error) {
 	if len(subCmdArgs) < 1 {
 		return "", nil, fmt.Errorf("Usage: remote %s <file_path>", c.Direction)
 	}
-	localFile := subCmdArgs[0]
+	if srcs, dest, ok, err := c.splitRemote(subCmdArgs); err != nil {
+		return "", nil, err
+	} else if ok {
+		return c.buildExplicit(remoteHost, srcs, dest, excludeFiles)
+	}
+	paths := subCmdArgs
+	if c.Direction == "push" {
+		var err error
+		if paths, err = expandGlobs(paths); err != nil {
+			return "", nil, err
+		}
+	}
+	if len(paths) > 1 || (c.Direction == "pull" && hasGlob(paths[0])) {
+		return c.buildRelative(remoteHost, paths, excludeFiles, cwdRel)
+	}
+
+	localFile := paths[0]
 	remoteFile := localFile
 	if !filepath.IsAbs(localFile) {
 		remoteFile = filepath.Join(cwdRel, localFile)
@@ -39,23 +234,165 @@ func (c *RsyncCommand) build(remoteHost string, subCmdArgs, excludeFiles []strin
 		localFileExists = true
 	}
 
-	rsyncArgs := make([]string, 0, 8)
-	for _, fname := range excludeFiles {
-		rsyncArgs = append(rsyncArgs, "--exclude", fname)
-	}
-
+	rsyncArgs := c.options(excludeFiles)
 	if c.Direction == "push" {
 		if !localFileExists {
 			return "", nil, fmt.Errorf("File not found: %q", localFile)
 		}
-		rsyncArgs = append(rsyncArgs, "-av", localFile, fmt.Sprintf("%s:%s", remoteHost, remoteFile))
+		rsyncArgs = append(rsyncArgs, localFile, fmt.Sprintf("%s:%s", remoteHost, remoteFile))
 		return "rsync", rsyncArgs, nil
 	}
 
 	if c.Direction == "pull" {
-		rsyncArgs = append(rsyncArgs, "-av", "--ignore-existing", fmt.Sprintf("%s:%s", remoteHost, remoteFile), localFile)
+		rsyncArgs = append(rsyncArgs, fmt.Sprintf("%s:%s", remoteHost, remoteFile), localFile)
 		return "rsync", rsyncArgs, nil
 	}
 	return "", nil, errors.New("unsupported rsync subcommand")
 }
 
+// buildRelative transfers several paths, or the matches of a remote glob,
+// in one run keeping their paths relative to the current directory.
+func (c *RsyncCommand) buildRelative(remoteHost string, paths, excludeFiles []string, cwdRel string) (string, []string, error) {
+	rsyncArgs := append(c.options(excludeFiles), "--relative")
+	for _, p := range paths {
+		if filepath.IsAbs(p) || p == ".." || strings.HasPrefix(filepath.Clean(p), ".."+string(filepath.Separator)) {
+			return "", nil, fmt.Errorf("Path outside the current directory cannot be transferred with other paths: %q", p)
+		}
+	}
+
+	root := strings.TrimSuffix(filepath.ToSlash(cwdRel), "/")
+	switch c.Direction {
+	case "push":
+		for _, p := range paths {
+			if _, err := os.Stat(p); err != nil {
+				return "", nil, fmt.Errorf("File not found: %q", p)
+			}
+		}
+		rsyncArgs = append(rsyncArgs, paths...)
+		rsyncArgs = append(rsyncArgs, fmt.Sprintf("%s:%s/", remoteHost, root))
+	case "pull":
+		// the implied directory marker keeps the paths relative to root
+		for _, p := range paths {
+			rsyncArgs = append(rsyncArgs, fmt.Sprintf("%s:%s/./%s", remoteHost, root, filepath.ToSlash(p)))
+		}
+		rsyncArgs = append(rsyncArgs, "./")
+	default:
+		return "", nil, errors.New("unsupported rsync subcommand")
+	}
+	return "rsync", rsyncArgs, nil
+}
+
+// splitRemote splits the arguments naming remote paths explicitly, with a
+// leading ":" like the host part of scp, into the sources and the destination.
+// A push takes local sources and an optional remote destination last; a pull
+// takes remote sources and an optional local destination last.
+func (c *RsyncCommand) splitRemote(args []string) (srcs []string, dest string, ok bool, err error) {
+	var remote, local []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, ":") {
+			remote = append(remote, arg[1:])
+		} else {
+			local = append(local, arg)
+		}
+	}
+	if len(remote) == 0 {
+		return nil, "", false, nil
+	}
+	last := args[len(args)-1]
+	switch c.Direction {
+	case "push":
+		if len(remote) > 1 || len(local) == 0 || !strings.HasPrefix(last, ":") {
+			return nil, "", false, errors.New("Usage: remote push <path>... :<dest>")
+		}
+		return local, remote[0], true, nil
+	case "pull":
+		dest = "./"
+		if len(local) > 0 {
+			if len(local) > 1 || strings.HasPrefix(last, ":") {
+				return nil, "", false, errors.New("Usage: remote pull :<path>... [dest]")
+			}
+			dest = last
+		}
+		return remote, dest, true, nil
+	}
+	return nil, "", false, errors.New("unsupported rsync subcommand")
+}
+
+// buildExplicit transfers srcs to dest as given, with the remote paths
+// resolved from the remote home directory like scp does and the trailing
+// slash rules of rsync: a source directory with a trailing slash copies its
+// content, and one without is copied into dest.
+func (c *RsyncCommand) buildExplicit(remoteHost string, srcs []string, dest string, excludeFiles []string) (string, []string, error) {
+	rsyncArgs := c.options(excludeFiles)
+	switch c.Direction {
+	case "push":
+		paths, err := expandGlobs(srcs)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, p := range paths {
+			if _, err := os.Stat(p); err != nil {
+				return "", nil, fmt.Errorf("File not found: %q", p)
+			}
+		}
+		rsyncArgs = append(rsyncArgs, paths...)
+		rsyncArgs = append(rsyncArgs, fmt.Sprintf("%s:%s", remoteHost, dest))
+	case "pull":
+		for _, p := range srcs {
+			rsyncArgs = append(rsyncArgs, fmt.Sprintf("%s:%s", remoteHost, p))
+		}
+		rsyncArgs = append(rsyncArgs, dest)
+	default:
+		return "", nil, errors.New("unsupported rsync subcommand")
+	}
+	return "rsync", rsyncArgs, nil
+}
+
+// options returns the rsync options preceding the paths.
+func (c *RsyncCommand) options(excludeFiles []string) []string {
+	rsyncArgs := make([]string, 0, 8)
+	for _, fname := range excludeFiles {
+		rsyncArgs = append(rsyncArgs, "--exclude", fname)
+	}
+	if c.Mirror {
+		rsyncArgs = append(rsyncArgs, "--delete")
+		for _, path := range c.Protect {
+			rsyncArgs = append(rsyncArgs, "--filter", "P "+path)
+		}
+	}
+	if c.Progress {
+		rsyncArgs = append(rsyncArgs, progressArgs...)
+	} else {
+		rsyncArgs = append(rsyncArgs, "-av")
+	}
+	if c.Direction == "pull" {
+		rsyncArgs = append(rsyncArgs, c.Strategy.args(c.backupSuffix)...)
+	}
+	return append(rsyncArgs, c.Options...)
+}
+
+// expandGlobs replaces the arguments that are not existing files but glob
+// patterns, as left unexpanded by shells finding no match or when quoted,
+// with the local files they match.
+func expandGlobs(args []string) ([]string, error) {
+	paths := make([]string, 0, len(args))
+	for _, arg := range args {
+		if _, err := os.Lstat(arg); err == nil || !hasGlob(arg) {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("No files match %q", arg)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+func hasGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
@@ -1,25 +1,27 @@
 package command
 
 import (
+	"bytes"
+	"context"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestRsyncCommand_build(t *testing.T) {
 	// Helper to create a dummy file for testing
 	createTempFile := func(t *testing.T) string {
-		f, err := os.CreateTemp("", "remote_test")
+		f, err := os.CreateTemp(t.TempDir(), "remote_test")
 		if err != nil {
 			t.Fatal(err)
 		}
 		f.Close()
 		return f.Name()
 	}
-	defer os.RemoveAll(os.TempDir()) // Not perfect cleanup but sufficient for unit tests
 
 	tmpFile := createTempFile(t)
-	defer os.Remove(tmpFile)
 
 	tests := []struct {
 		name         string
@@ -105,3 +107,252 @@ func TestRsyncCommand_build(t *testing.T) {
 	}
 }
 
+func TestRsyncCommand_buildMirror(t *testing.T) {
+	dir := t.TempDir()
+	c := &RsyncCommand{Direction: "push", Mirror: true, Protect: []string{"data/", "*.db"}}
+	_, gotArgs, err := c.build("example.com", []string{dir}, []string{".git"}, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"--exclude", ".git", "--delete", "--filter", "P data/", "--filter", "P *.db", "-av", dir + "/", "example.com:" + dir + "/"}
+	if !reflect.DeepEqual(gotArgs, want) {
+		t.Errorf("RsyncCommand.build() args = %q, want %q", gotArgs, want)
+	}
+}
+
+func TestRsyncCommand_confirmDeletions(t *testing.T) {
+	bin := t.TempDir()
+	script := "#!/bin/sh\nprintf '*deleting   old.txt\\n*deleting   tmp/\\n>f+++++++++ new.txt\\n'\n"
+	if err := os.WriteFile(filepath.Join(bin, "rsync"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name    string
+		yes     bool
+		input   string
+		noStdin bool
+		wantErr bool
+	}{
+		{name: "confirmed", input: "y\n"},
+		{name: "no stdin", noStdin: true, wantErr: true},
+		{name: "declined", input: "n\n", wantErr: true},
+		{name: "no answer", input: "", wantErr: true},
+		{name: "yes flag", yes: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			ctx := NewContext(context.Background(), nil, nil, ".")
+			ctx.Stdin = strings.NewReader(tt.input)
+			if tt.noStdin {
+				ctx.Stdin = nil
+			}
+			ctx.Stderr = &stderr
+			c := &RsyncCommand{Direction: "push", Mirror: true, Yes: tt.yes}
+			err := c.confirmDeletions(ctx, "example.com", "rsync", []string{"--delete", "src/", "example.com:src/"})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("confirmDeletions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			want := "The following 2 files will be deleted on example.com:\n  old.txt\n  tmp/\n"
+			if !strings.HasPrefix(stderr.String(), want) {
+				t.Errorf("stderr = %q, want prefix %q", stderr.String(), want)
+			}
+			steps := ctx.Steps()
+			if len(steps) != 1 || steps[0].Args[0] != "--dry-run" {
+				t.Errorf("steps = %v, want a single preview with --dry-run", steps)
+			}
+		})
+	}
+}
+
+func TestRsyncCommand_confirmDeletions_verbose(t *testing.T) {
+	bin := t.TempDir()
+	// the output of rsync -av --itemize-changes, the file list of -v included
+	script := "#!/bin/sh\ncat <<'EOF'\n" +
+		"sending incremental file list\n" +
+		"*deleting   old.txt\n" +
+		"deleting list.txt\n" +
+		".d..t...... ./\n" +
+		">f+++++++++ new.txt\n" +
+		"*deleting   tmp/\n" +
+		"\n" +
+		"sent 97 bytes  received 28 bytes  250.00 bytes/sec\n" +
+		"total size is 1,024  speedup is 8.19 (DRY RUN)\n" +
+		"EOF\n"
+	if err := os.WriteFile(filepath.Join(bin, "rsync"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	var stderr bytes.Buffer
+	ctx := NewContext(context.Background(), nil, nil, ".")
+	ctx.IsVerbose = true
+	ctx.Stderr = &stderr
+	c := &RsyncCommand{Direction: "push", Mirror: true, Yes: true}
+	if err := c.confirmDeletions(ctx, "example.com", "rsync", []string{"--delete", "-av", "src/", "example.com:src/"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "The following 2 files will be deleted on example.com:\n  old.txt\n  tmp/\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+}
+
+func TestRsyncCommand_buildRelative(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.py", "b.py", "src/c.py"} {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		name       string
+		direction  string
+		subCmdArgs []string
+		wantArgs   []string
+		wantErr    bool
+	}{
+		{
+			name:       "push several paths",
+			direction:  "push",
+			subCmdArgs: []string{"a.py", "src/c.py"},
+			wantArgs:   []string{"-av", "--relative", "a.py", "src/c.py", "example.com:proj/"},
+		},
+		{
+			name:       "push glob",
+			direction:  "push",
+			subCmdArgs: []string{"*.py", "src"},
+			wantArgs:   []string{"-av", "--relative", "a.py", "b.py", "src", "example.com:proj/"},
+		},
+		{
+			name:       "push glob without match",
+			direction:  "push",
+			subCmdArgs: []string{"*.go"},
+			wantErr:    true,
+		},
+		{
+			name:       "push path outside",
+			direction:  "push",
+			subCmdArgs: []string{"a.py", "../b.py"},
+			wantErr:    true,
+		},
+		{
+			name:       "pull several paths",
+			direction:  "pull",
+			subCmdArgs: []string{"a.log", "logs/b.log"},
+			wantArgs:   []string{"-av", "--ignore-existing", "--relative", "example.com:proj/./a.log", "example.com:proj/./logs/b.log", "./"},
+		},
+		{
+			name:       "pull remote glob",
+			direction:  "pull",
+			subCmdArgs: []string{"logs/*.log"},
+			wantArgs:   []string{"-av", "--ignore-existing", "--relative", "example.com:proj/./logs/*.log", "./"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &RsyncCommand{Direction: tt.direction}
+			_, gotArgs, err := c.build("example.com", tt.subCmdArgs, nil, "proj")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RsyncCommand.build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("RsyncCommand.build() args = %q, want %q", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestRsyncCommand_buildExplicit(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		direction  string
+		subCmdArgs []string
+		wantArgs   []string
+		wantErr    bool
+	}{
+		{
+			name:       "push into absolute dir",
+			direction:  "push",
+			subCmdArgs: []string{file, ":/etc/app/"},
+			wantArgs:   []string{"-av", file, "example.com:/etc/app/"},
+		},
+		{
+			name:       "push dir content to home",
+			direction:  "push",
+			subCmdArgs: []string{dir + "/", ":~/backup"},
+			wantArgs:   []string{"-av", dir + "/", "example.com:~/backup"},
+		},
+		{
+			name:       "push to home dir",
+			direction:  "push",
+			subCmdArgs: []string{file, ":"},
+			wantArgs:   []string{"-av", file, "example.com:"},
+		},
+		{
+			name:       "push destination not last",
+			direction:  "push",
+			subCmdArgs: []string{":/etc/app/", file},
+			wantErr:    true,
+		},
+		{
+			name:       "push without source",
+			direction:  "push",
+			subCmdArgs: []string{":/etc/app/"},
+			wantErr:    true,
+		},
+		{
+			name:       "pull into dir",
+			direction:  "pull",
+			subCmdArgs: []string{":/var/log/app.log", ":~/logs/*.log", "tmp/"},
+			wantArgs:   []string{"-av", "--ignore-existing", "example.com:/var/log/app.log", "example.com:~/logs/*.log", "tmp/"},
+		},
+		{
+			name:       "pull into current dir",
+			direction:  "pull",
+			subCmdArgs: []string{":/var/log/app.log"},
+			wantArgs:   []string{"-av", "--ignore-existing", "example.com:/var/log/app.log", "./"},
+		},
+		{
+			name:       "pull with several destinations",
+			direction:  "pull",
+			subCmdArgs: []string{"a", ":/var/log/app.log", "b"},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &RsyncCommand{Direction: tt.direction}
+			_, gotArgs, err := c.build("example.com", tt.subCmdArgs, nil, "proj")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RsyncCommand.build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("RsyncCommand.build() args = %q, want %q", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
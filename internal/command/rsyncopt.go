@@ -0,0 +1,104 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+)
+
+// deniedRsyncOptions are the rsync options conflicting with how the
+// transfers are built, with the reason given when one is used.
+var deniedRsyncOptions = map[string]string{
+	"-e":                    "remote sets up the ssh transport",
+	"--rsh":                 "remote sets up the ssh transport",
+	"-R":                    "remote decides how paths are mapped",
+	"--relative":            "remote decides how paths are mapped",
+	"--no-relative":         "remote decides how paths are mapped",
+	"--no-R":                "remote decides how paths are mapped",
+	"--files-from":          "remote decides which files are transferred",
+	"-0":                    "remote decides which files are transferred",
+	"--from0":               "remote decides which files are transferred",
+	"--server":              "it is internal to rsync",
+	"--sender":              "it is internal to rsync",
+	"--daemon":              "remote transfers over ssh",
+	"-n":                    "use remote --dry-run",
+	"--dry-run":             "use remote --dry-run",
+	"--list-only":           "use remote diff",
+	"-i":                    "remote parses the output of rsync",
+	"--itemize-changes":     "remote parses the output of rsync",
+	"--info":                "remote parses the output of rsync",
+	"--out-format":          "remote parses the output of rsync",
+	"--del":                 "use push --mirror",
+	"--delete":              "use push --mirror",
+	"--delete-before":       "use push --mirror",
+	"--delete-during":       "use push --mirror",
+	"--delete-delay":        "use push --mirror",
+	"--delete-after":        "use push --mirror",
+	"--delete-excluded":     "use push --mirror",
+	"--ignore-existing":     "use the pull strategy flags",
+	"--existing":            "use the pull strategy flags",
+	"-u":                    "use the pull strategy flags",
+	"--update":              "use the pull strategy flags",
+	"-b":                    "use the pull strategy flags",
+	"--backup":              "use the pull strategy flags",
+	"--suffix":              "use the pull strategy flags",
+	"--remove-source-files": "remote never deletes the source files",
+}
+
+// shortValueOptions are the single-letter rsync options taking a value, which
+// ends a group of single-letter options such as -avzT.
+const shortValueOptions = "eBfMT@"
+
+// checkRsyncOptions returns an error naming source if one of args is denied.
+func checkRsyncOptions(source string, args []string) error {
+	for _, arg := range args {
+		for _, opt := range optionNames(arg) {
+			if reason, ok := deniedRsyncOptions[opt]; ok {
+				return fmt.Errorf("%s: rsync option %q cannot be used: %s", source, arg, reason)
+			}
+		}
+	}
+	return nil
+}
+
+// optionNames returns the names of the rsync options given by arg.
+func optionNames(arg string) []string {
+	if strings.HasPrefix(arg, "--") {
+		return []string{strings.SplitN(arg, "=", 2)[0]}
+	}
+	if !strings.HasPrefix(arg, "-") {
+		return nil
+	}
+	var names []string
+	for _, r := range arg[1:] {
+		names = append(names, "-"+string(r))
+		if strings.ContainsRune(shortValueOptions, r) {
+			break
+		}
+	}
+	return names
+}
+
+// rsyncOptions returns the configured options for transfers in direction,
+// followed by extra, after checking none of them is denied.
+func rsyncOptions(ctx *Context, direction string, extra []string) ([]string, error) {
+	cfg := ctx.Config
+	sets := []struct {
+		source string
+		args   []string
+	}{
+		{"rsyncOptions", cfg.RsyncOptions},
+		{direction + "Options", cfg.PushOptions},
+		{"arguments after --", extra},
+	}
+	if direction == "pull" {
+		sets[1].args = cfg.PullOptions
+	}
+	var opts []string
+	for _, set := range sets {
+		if err := checkRsyncOptions(set.source, set.args); err != nil {
+			return nil, err
+		}
+		opts = append(opts, set.args...)
+	}
+	return opts, nil
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func TestCheckRsyncOptions(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{args: []string{"--compress", "--checksum", "--chmod=D755,F644", "--bwlimit", "1000", "--partial"}},
+		{args: []string{"-zc"}},
+		{args: []string{"-zT", "-n"}, wantErr: true},
+		{args: []string{"-zTn"}},
+		{args: []string{"--delete"}, wantErr: true},
+		{args: []string{"--rsh=ssh -p 2222"}, wantErr: true},
+		{args: []string{"-avR"}, wantErr: true},
+		{args: []string{"--files-from", "list"}, wantErr: true},
+		{args: []string{"--server"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		if err := checkRsyncOptions("test", tt.args); (err != nil) != tt.wantErr {
+			t.Errorf("checkRsyncOptions(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRsyncCommand_options(t *testing.T) {
+	cfg := &config.Config{
+		RsyncOptions: []string{"--compress"},
+		PushOptions:  []string{"--chmod=F644"},
+		PullOptions:  []string{"--partial"},
+	}
+	ctx := NewContext(context.Background(), cfg, nil, "proj")
+	ctx.Passthrough = []string{"--checksum"}
+
+	c := &RsyncCommand{Direction: "pull"}
+	opts, err := rsyncOptions(ctx, c.Direction, ctx.Passthrough)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Options = opts
+	_, got, err := c.build("example.com", []string{"app.log"}, nil, "proj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-av", "--ignore-existing", "--compress", "--partial", "--checksum", "example.com:proj/app.log", "app.log"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RsyncCommand.build() args = %q, want %q", got, want)
+	}
+
+	cfg.PushOptions = []string{"--delete"}
+	if _, err := rsyncOptions(ctx, "push", nil); err == nil || err.Error() != `pushOptions: rsync option "--delete" cannot be used: use push --mirror` {
+		t.Errorf("rsyncOptions() error = %v, want denied pushOptions", err)
+	}
+}
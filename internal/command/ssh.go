@@ -1,59 +1,223 @@
 package command
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+
+	"github.com/yhiraki/remote/internal/shell"
+	"github.com/yhiraki/remote/internal/term"
+	"github.com/yhiraki/remote/internal/trace"
 )
 
-type SSHCommand struct{}
+func init() {
+	Register(&Spec{
+		Name:    "sh",
+		Usage:   "[command [args...]]",
+		Summary: "Run a command, or a login shell, in the current directory on the remote host (default)",
+		Examples: []string{
+			"remote",
+			`remote sh grep "foo bar" file`,
+			"remote sh -e DEBUG=1 make test",
+			"remote sh -e API_TOKEN --env-file .env.test make deploy",
+			"remote sh --raw 'ls | wc -l'",
+			"tar c . | remote sh tar x",
+		},
+		New: func() Command { return &SSHCommand{} },
+	})
+}
+
+type SSHCommand struct {
+	EnvVars stringSlice
+	EnvFile string
+	IsRaw   bool
+	TTY     TTYMode
+	// Transport is how EnvVars reach the remote command, envTransport of
+	// the config if empty, and otherwise selected as EnvAuto says.
+	Transport EnvTransport
+}
+
+func (c *SSHCommand) SetFlags(fs *flag.FlagSet) {
+	fs.Var(&c.EnvVars, "e", "set environment variable (e.g. -e KEY=VALUE), or forward the local value with -e KEY")
+	fs.Var(&c.EnvVars, "env", "set environment variable (e.g. --env KEY=VALUE), or forward the local value with --env KEY")
+	fs.StringVar(&c.EnvFile, "env-file", "", "set the environment variables of a .env file")
+	fs.BoolVar(&c.IsRaw, "raw", false, "pass the command to the remote shell as a snippet instead of quoting each argument")
+	fs.Var(TTYFlag{Mode: &c.TTY, Value: TTYForce}, "t", "force pty allocation")
+	fs.Var(TTYFlag{Mode: &c.TTY, Value: TTYForce}, "tty", "force pty allocation")
+	fs.Var(TTYFlag{Mode: &c.TTY, Value: TTYDisable}, "T", "disable pty allocation")
+	fs.Var(TTYFlag{Mode: &c.TTY, Value: TTYDisable}, "no-tty", "disable pty allocation")
+}
 
 func (c *SSHCommand) Execute(ctx *Context) error {
-	cmdName, cmdArgs, err := c.build(ctx.RemoteHost, ctx.Args, ctx.EnvVars, ctx.CwdRel)
+	remoteHost, err := ctx.RemoteHost()
 	if err != nil {
 		return err
 	}
-	return executeSubCommand(cmdName, cmdArgs, ctx.IsDryRun)
-}
+	env, err := resolveEnv(c.EnvVars, envFiles(ctx, c.EnvFile))
+	if err != nil {
+		return err
+	}
+	if c.Transport == "" && ctx.Config != nil {
+		if c.Transport, err = parseEnvTransport(ctx.Config.EnvTransport); err != nil {
+			return err
+		}
+	}
+	tty := c.TTY.wantTTY(ctx.Stdin, ctx.Stdout)
+	if c.Transport == EnvAuto {
+		c.Transport = autoEnvTransport(ctx.Stdin, tty)
+	}
+	cmdName, cmdArgs, err := c.build(remoteHost, ctx.Args, env, ctx.CwdRel, c.IsRaw, tty)
+	if err != nil {
+		return err
+	}
+	_, shownArgs, _ := c.build(remoteHost, ctx.Args, maskEnv(env), ctx.CwdRel, c.IsRaw, tty)
+	opts, err := sshOptions(ctx, remoteHost)
+	if err != nil {
+		return err
+	}
+	opts = opts[:len(opts):len(opts)] // shared by both steps
+	step := Step{Command: cmdName, Args: append(opts, cmdArgs...)}
+	shown := Step{Command: cmdName, Args: append(opts, shownArgs...)}
+	if len(env) == 0 {
+		return executeStep(ctx, step, shown)
+	}
+	shown.Env = maskEnv(env)
 
-func (c *SSHCommand) build(remoteHost string, subCmdArgs, envVars []string, cwdRel string) (string, []string, error) {
-	shCmd := strings.Join(subCmdArgs, " ")
-	if shCmd == "" {
-		shCmd = "$SHELL"
+	switch c.Transport {
+	case EnvSendEnv:
+		var sendEnv []string
+		for _, v := range env {
+			key, _, _ := strings.Cut(v, "=")
+			sendEnv = append(sendEnv, "-o", "SendEnv="+key)
+		}
+		sendEnv = sendEnv[:len(sendEnv):len(sendEnv)]
+		step.Args = append(sendEnv, step.Args...)
+		shown.Args = append(sendEnv, shown.Args...)
+		step.Env = env
+	case EnvStdin:
+		if f, ok := ctx.Stdin.(*os.File); tty || ok && term.IsTerminal(f) {
+			return errors.New("envTransport stdin cannot be used with a terminal on stdin; use sendenv, or redirect stdin")
+		}
+		line := shell.Join(env)
+		if strings.ContainsAny(line, "\n\r") {
+			return errors.New("envTransport stdin cannot send values containing newlines")
+		}
+		sctx := *ctx
+		sctx.Stdin = strings.NewReader(line + "\n")
+		if ctx.Stdin != nil {
+			sctx.Stdin = io.MultiReader(sctx.Stdin, ctx.Stdin)
+		}
+		ctx = &sctx
 	}
+	return executeStep(ctx, step, shown)
+}
 
-	envCmd := ""
-	if len(envVars) > 0 {
-		var quotedEnvVars []string
-		for _, envVar := range envVars {
-			quotedEnvVars = append(quotedEnvVars, fmt.Sprintf("'%s'", envVar))
+// secrets returns the environment variables given with their values.
+func (c *SSHCommand) secrets() []string {
+	var secrets []string
+	for _, v := range c.EnvVars {
+		if strings.Contains(v, "=") {
+			secrets = append(secrets, v)
 		}
-		envCmd = "env " + strings.Join(quotedEnvVars, " ") + " "
 	}
+	return secrets
+}
 
-	finalCmd := ""
-	if shCmd == "$SHELL" {
-		finalCmd = fmt.Sprintf("cd '%s'; exec %s%s", cwdRel, envCmd, shCmd)
-	} else {
-		escapedShCmd := strings.ReplaceAll(shCmd, "'", "'\\''")
-		finalCmd = fmt.Sprintf("cd '%s'; exec %s sh -c '%s'", cwdRel, envCmd, escapedShCmd)
+// build returns the ssh invocation for running subCmdArgs in cwdRel on the remote host.
+// Each element of subCmdArgs reaches the remote command as one argument, unless isRaw is set,
+// in which case they are joined into a shell snippet and run with sh -c.
+// A pty is requested only when tty is set, so that binary output survives pipelines.
+func (c *SSHCommand) build(remoteHost string, subCmdArgs, envVars []string, cwdRel string, isRaw, tty bool) (string, []string, error) {
+	envCmd, readEnv := "", ""
+	switch {
+	case len(envVars) == 0 || c.Transport == EnvSendEnv:
+	case c.Transport == EnvStdin:
+		// the first line of stdin holds the variables quoted for the shell
+		readEnv = `IFS= read -r REMOTE_ENV && eval "export $REMOTE_ENV" && unset REMOTE_ENV || exit 1; `
+	default:
+		envCmd = "env " + shell.Join(envVars) + " "
 	}
-	return "ssh", []string{remoteHost, "-t", finalCmd}, nil
+
+	shCmd := ""
+	switch {
+	case len(subCmdArgs) == 0:
+		shCmd = "$SHELL"
+	case isRaw:
+		shCmd = "sh -c " + shell.Quote(strings.Join(subCmdArgs, " "))
+	default:
+		shCmd = shell.Join(subCmdArgs)
+	}
+
+	finalCmd := fmt.Sprintf("cd %s; %sexec %s%s", shell.Quote(cwdRel), readEnv, envCmd, shCmd)
+	ttyOpt := "-T"
+	if tty {
+		ttyOpt = "-t"
+	}
+	return "ssh", []string{remoteHost, ttyOpt, finalCmd}, nil
+}
+
+func executeSubCommand(ctx *Context, name string, args []string) error {
+	step := Step{Command: name, Args: args}
+	return executeStep(ctx, step, step)
 }
 
-func executeSubCommand(name string, args []string, isDryRun bool) error {
-	cmd := exec.Command(name, args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if isDryRun {
-		fmt.Println(cmd.Args)
+// executeStep runs step, showing shown instead in the plan and the logs so
+// that the values of secrets are masked.
+func executeStep(ctx *Context, step, shown Step) error {
+	if step.Dir == "" {
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		step.Dir = dir
+	}
+	shown.Dir = step.Dir
+	ctx.plan.add(shown)
+	if ctx.DryRun != DryRunOff {
 		return nil
 	}
-	if err := cmd.Run(); err != nil {
-		return err
+	words := append(append([]string{}, shown.Env...), shown.Command)
+	slog.Debug("executing", "command", shell.Join(append(words, shown.Args...)), "dir", shown.Dir)
+
+	cmd := exec.CommandContext(ctx.Ctx, step.Command, step.Args...)
+	cmd.Dir = step.Dir
+	if len(step.Env) > 0 {
+		cmd.Env = append(os.Environ(), step.Env...)
+	}
+	cmd.Stdin = ctx.Stdin
+	cmd.Stdout = ctx.Stdout
+	cmd.Stderr = ctx.Stderr
+
+	sctx, span := trace.Start(ctx.Ctx, stepSpanName(step.Command))
+	defer span.End()
+	if span != nil && filepath.Base(step.Command) == "ssh" {
+		defer traceSSH(sctx, span, cmd)()
 	}
-	return nil
+	return runProcess(cmd)
 }
 
+// readRemote runs remoteCmd, which only reads, on remoteHost and returns its
+// output. The step is added to the plan but runs in dry-run mode too, as
+// commands such as diff and sync plan nothing without what it reads.
+func readRemote(ctx *Context, remoteHost, remoteCmd string) ([]byte, error) {
+	opts, err := hostKeyOptions(ctx, remoteHost, true)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	args := append(opts, remoteHost, "-T", remoteCmd)
+	ctx.plan.add(Step{Command: "ssh", Args: args, Dir: dir})
+	cmd := exec.CommandContext(ctx.Ctx, "ssh", args...)
+	cmd.Dir = dir
+	cmd.Stderr = ctx.Stderr
+	return cmd.Output()
+}
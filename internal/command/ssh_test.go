@@ -1,7 +1,10 @@
 package command
 
 import (
+	"bytes"
+	"os/exec"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -12,6 +15,8 @@ func TestSSHCommand_build(t *testing.T) {
 		subCmdArgs []string
 		envVars    []string
 		cwdRel     string
+		isRaw      bool
+		noTTY      bool
 		wantCmd    string
 		wantArgs   []string
 	}{
@@ -22,7 +27,7 @@ func TestSSHCommand_build(t *testing.T) {
 			envVars:    nil,
 			cwdRel:     ".",
 			wantCmd:    "ssh",
-			wantArgs:   []string{"example.com", "-t", "cd '.'; exec $SHELL"},
+			wantArgs:   []string{"example.com", "-t", "cd .; exec $SHELL"},
 		},
 		{
 			name:       "simple command",
@@ -31,7 +36,7 @@ func TestSSHCommand_build(t *testing.T) {
 			envVars:    nil,
 			cwdRel:     "src",
 			wantCmd:    "ssh",
-			wantArgs:   []string{"example.com", "-t", "cd 'src'; exec  sh -c 'ls -la'"},
+			wantArgs:   []string{"example.com", "-t", "cd src; exec ls -la"},
 		},
 		{
 			name:       "command with env vars",
@@ -40,7 +45,7 @@ func TestSSHCommand_build(t *testing.T) {
 			envVars:    []string{"FOO=BAR", "BAZ=QUX"},
 			cwdRel:     ".",
 			wantCmd:    "ssh",
-			wantArgs:   []string{"example.com", "-t", "cd '.'; exec env 'FOO=BAR' 'BAZ=QUX'  sh -c 'env'"},
+			wantArgs:   []string{"example.com", "-t", "cd .; exec env 'FOO=BAR' 'BAZ=QUX' env"},
 		},
 		{
 			name:       "command with single quotes",
@@ -49,14 +54,52 @@ func TestSSHCommand_build(t *testing.T) {
 			envVars:    nil,
 			cwdRel:     ".",
 			wantCmd:    "ssh",
-			wantArgs:   []string{"example.com", "-t", "cd '.'; exec  sh -c 'echo '\\''hello'\\'''"},
+			wantArgs:   []string{"example.com", "-t", "cd .; exec echo ''\\''hello'\\'''"},
+		},
+		{
+			name:       "argument with spaces",
+			remoteHost: "example.com",
+			subCmdArgs: []string{"grep", "foo bar", "file"},
+			envVars:    nil,
+			cwdRel:     ".",
+			wantCmd:    "ssh",
+			wantArgs:   []string{"example.com", "-t", "cd .; exec grep 'foo bar' file"},
+		},
+		{
+			name:       "cwd with single quote",
+			remoteHost: "example.com",
+			subCmdArgs: []string{},
+			envVars:    []string{"MSG=it's"},
+			cwdRel:     "bob's project",
+			wantCmd:    "ssh",
+			wantArgs:   []string{"example.com", "-t", "cd 'bob'\\''s project'; exec env 'MSG=it'\\''s' $SHELL"},
+		},
+		{
+			name:       "raw snippet",
+			remoteHost: "example.com",
+			subCmdArgs: []string{"ls", "|", "wc", "-l"},
+			envVars:    nil,
+			cwdRel:     "src",
+			isRaw:      true,
+			wantCmd:    "ssh",
+			wantArgs:   []string{"example.com", "-t", "cd src; exec sh -c 'ls | wc -l'"},
+		},
+		{
+			name:       "without tty",
+			remoteHost: "example.com",
+			subCmdArgs: []string{"cat", "file"},
+			envVars:    nil,
+			cwdRel:     "src",
+			noTTY:      true,
+			wantCmd:    "ssh",
+			wantArgs:   []string{"example.com", "-T", "cd src; exec cat file"},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &SSHCommand{}
-			gotCmd, gotArgs, err := c.build(tt.remoteHost, tt.subCmdArgs, tt.envVars, tt.cwdRel)
+			gotCmd, gotArgs, err := c.build(tt.remoteHost, tt.subCmdArgs, tt.envVars, tt.cwdRel, tt.isRaw, !tt.noTTY)
 			if err != nil {
 				t.Errorf("SSHCommand.build() error = %v", err)
 				return
@@ -71,3 +114,42 @@ func TestSSHCommand_build(t *testing.T) {
 	}
 }
 
+// FuzzSSHCommand_build runs the generated remote command line with a local sh
+// and checks that arguments and environment values arrive unchanged.
+func FuzzSSHCommand_build(f *testing.F) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		f.Skip("sh not found")
+	}
+	f.Add("foo bar", "it's", "$HOME")
+	f.Add("*", "a\nb", "`id`")
+	f.Add("", "-n", `\'"`)
+
+	f.Fuzz(func(t *testing.T, arg1, arg2, envValue string) {
+		for _, s := range []string{arg1, arg2, envValue} {
+			if strings.ContainsRune(s, 0) {
+				t.Skip()
+			}
+		}
+		subCmdArgs := []string{"sh", "-c", `printf '%s\0' "$FUZZ_VALUE" "$@"`, "sh", arg1, arg2}
+		c := &SSHCommand{}
+		_, args, err := c.build("example.com", subCmdArgs, []string{"FUZZ_VALUE=" + envValue}, ".", false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := exec.Command("sh", "-c", args[len(args)-1]).Output()
+		if err != nil {
+			t.Fatalf("sh -c %q: %v", args[len(args)-1], err)
+		}
+		got := bytes.Split(bytes.TrimSuffix(out, []byte{0}), []byte{0})
+		want := []string{envValue, arg1, arg2}
+		if len(got) != len(want) {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+		for i := range want {
+			if string(got[i]) != want[i] {
+				t.Errorf("argument %d = %q, want %q", i, got[i], want[i])
+			}
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yhiraki/remote/internal/trace"
+)
+
+// sshLogDrainTimeout is how long the log of ssh is read after it exited,
+// as a master connection left running keeps the log open.
+const sshLogDrainTimeout = 100 * time.Millisecond
+
+// stepSpanName names the span of running command in the trace.
+func stepSpanName(command string) string {
+	if name := filepath.Base(command); name != "rsync" {
+		return name
+	}
+	return "transfer"
+}
+
+// sshVerboseMessages are the prefixes of the messages ssh logs at
+// LogLevel=VERBOSE but not at the default level. The log does not tell the
+// two levels apart, so they are matched by their text.
+var sshVerboseMessages = []string{
+	"Authenticated to ",
+	"Authenticating to ",
+	"Bytes per second: ",
+	"Connecting to ",
+	"Connection established.",
+	"Offering public key: ",
+	"Server accepts key: ",
+	"Server host key: ",
+	"Transferred: ",
+	"Will attempt key: ",
+}
+
+// sshLog parses the log of ssh run with LogLevel=VERBOSE, relaying the
+// messages shown at the default level to stderr.
+type sshLog struct {
+	stderr        io.Writer
+	authenticated time.Time
+	method        string
+	sent          int64
+	received      int64
+}
+
+func (l *sshLog) parse(r io.Reader) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "Authenticated to "):
+			if l.authenticated.IsZero() {
+				l.authenticated = time.Now()
+				_, method, _ := strings.Cut(line, " using ")
+				l.method = strings.Trim(method, `".`)
+			}
+		case strings.HasPrefix(line, "Transferred: "):
+			fmt.Sscanf(line, "Transferred: sent %d, received %d bytes", &l.sent, &l.received)
+		}
+		if !isSSHVerboseMessage(line) {
+			fmt.Fprintln(l.stderr, line)
+		}
+	}
+}
+
+func isSSHVerboseMessage(line string) bool {
+	for _, prefix := range sshVerboseMessages {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// record adds the spans of the connection and of the remote command, in the
+// span of ctx, to the trace. They are missing when ssh reused a master
+// connection, which it does not log.
+func (l *sshLog) record(ctx context.Context, span *trace.Span, started, exited time.Time) {
+	if l.sent > 0 || l.received > 0 {
+		span.SetAttr("bytes_sent", l.sent)
+		span.SetAttr("bytes_received", l.received)
+	}
+	if l.authenticated.IsZero() {
+		return
+	}
+	trace.Record(ctx, "connection", started, l.authenticated).SetAttr("auth", l.method)
+	trace.Record(ctx, "remote execution", l.authenticated, exited)
+}
+
+// lockedWriter serializes the writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
@@ -0,0 +1,57 @@
+//go:build linux || darwin
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/yhiraki/remote/internal/trace"
+)
+
+// traceSSH makes cmd, running ssh, log to a pipe at the VERBOSE level to
+// time the connection apart from the remote command. The returned function
+// records the spans once cmd exited.
+func traceSSH(ctx context.Context, span *trace.Span, cmd *exec.Cmd) (finish func()) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		slog.Warn("could not trace the ssh connection", "err", err)
+		return func() {}
+	}
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, w)
+	cmd.Args = append([]string{cmd.Args[0], "-o", "LogLevel=VERBOSE", "-E", fmt.Sprintf("/dev/fd/%d", fd)}, cmd.Args[1:]...)
+
+	l := &sshLog{stderr: cmd.Stderr}
+	switch cmd.Stderr.(type) {
+	case nil:
+		l.stderr = io.Discard
+	case *os.File:
+	default:
+		// written to by exec as well
+		cmd.Stderr = &lockedWriter{w: cmd.Stderr}
+		l.stderr = cmd.Stderr
+	}
+	done := make(chan struct{})
+	go func() {
+		l.parse(r)
+		close(done)
+	}()
+	started := time.Now()
+	return func() {
+		exited := time.Now()
+		w.Close()
+		select {
+		case <-done:
+		case <-time.After(sshLogDrainTimeout):
+		}
+		r.Close()
+		<-done
+		l.record(ctx, span, started, exited)
+	}
+}
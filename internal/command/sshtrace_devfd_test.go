@@ -0,0 +1,80 @@
+//go:build linux || darwin
+
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yhiraki/remote/internal/trace"
+)
+
+func TestExecuteStep_traceSSH(t *testing.T) {
+	dir := t.TempDir()
+	// a fake ssh logging as OpenSSH does to the file given with -E
+	script := `#!/bin/sh
+while [ "$1" != -E ]; do shift; done
+log=$2
+echo 'Authenticated to example.com ([192.0.2.1]:22) using "publickey".' >>"$log"
+echo 'Server accepts key: /home/user/.ssh/id_ed25519 ED25519 SHA256:abc' >>"$log"
+echo hello
+echo 'Warning: Permanently added the host key' >>"$log"
+echo 'Transferred: sent 2412, received 2728 bytes, in 0.1 seconds' >>"$log"
+echo 'Bytes per second: sent 24120.0, received 27280.0' >>"$log"
+`
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tr := trace.New()
+	var stdout, stderr bytes.Buffer
+	ctx := NewContext(trace.NewContext(context.Background(), tr), nil, nil, ".")
+	ctx.Stdout = &stdout
+	ctx.Stderr = &stderr
+	if err := executeSubCommand(ctx, "ssh", []string{"example.com", "-T", "true"}); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "hello\n" {
+		t.Errorf("stdout = %q, want hello", stdout.String())
+	}
+	if want := "Warning: Permanently added the host key\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+	// the plan shows the command as run without tracing
+	if args := ctx.Steps()[0].Args; strings.Join(args, " ") != "example.com -T true" {
+		t.Errorf("planned args = %q", args)
+	}
+
+	var b bytes.Buffer
+	if err := tr.WriteChrome(&b); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		TraceEvents []struct {
+			Name string            `json:"name"`
+			Args map[string]string `json:"args"`
+		} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range got.TraceEvents[1:] {
+		names = append(names, e.Name)
+	}
+	if want := "ssh connection remote execution"; strings.Join(names, " ") != want {
+		t.Fatalf("spans = %q, want %q", names, want)
+	}
+	if args := got.TraceEvents[1].Args; args["bytes_sent"] != "2412" || args["bytes_received"] != "2728" {
+		t.Errorf("ssh span args = %v", args)
+	}
+	if args := got.TraceEvents[2].Args; args["auth"] != "publickey" {
+		t.Errorf("connection span args = %v", args)
+	}
+}
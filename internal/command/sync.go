@@ -0,0 +1,359 @@
+package command
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/yhiraki/remote/internal/bisync"
+	"github.com/yhiraki/remote/internal/rsync"
+	"github.com/yhiraki/remote/internal/shell"
+	"github.com/yhiraki/remote/internal/trace"
+)
+
+func init() {
+	Register(&Spec{
+		Name:         "sync",
+		Usage:        "[dir]",
+		Summary:      "Synchronize a directory both ways, stopping on files changed on both sides",
+		Examples:     []string{"remote sync", "remote sync --keep-local src", "remote sync -- --checksum"},
+		Interspersed: true,
+		Passthrough:  true,
+		New:          func() Command { return &SyncCommand{} },
+	})
+}
+
+// remoteHashCommand prints the SHA-256 of every file under the current
+// directory in the format of sha256sum, which some systems lack.
+const remoteHashCommand = `if command -v sha256sum >/dev/null 2>&1; then find . -type f -exec sha256sum {} +; else find . -type f -exec shasum -a 256 {} +; fi`
+
+// remoteDirMissing is the exit status of the remote scan when the remote
+// directory does not exist, apart from those of ssh and the shell.
+const remoteDirMissing = 3
+
+// maxLocalDeletions is the number of local deletions above which sync asks
+// for confirmation, as a remote directory emptied by mistake would otherwise
+// empty the local one.
+const maxLocalDeletions = 10
+
+type SyncCommand struct {
+	KeepLocal  bool
+	KeepRemote bool
+	Merge      bool
+	Yes        bool // delete many local files without asking for confirmation
+	Transfer   TransferOptions
+}
+
+func (c *SyncCommand) SetFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.KeepLocal, "keep-local", false, "resolve conflicts with the local files")
+	fs.BoolVar(&c.KeepRemote, "keep-remote", false, "resolve conflicts with the remote files")
+	fs.BoolVar(&c.Merge, "merge", false, "download the remote side of conflicts into the cache dir to merge by hand")
+	fs.BoolVar(&c.Yes, "yes", false, fmt.Sprintf("delete more than %d local files without asking for confirmation", maxLocalDeletions))
+	c.Transfer.SetFlags(fs)
+}
+
+func (c *SyncCommand) Complete(ctx *Context, args []string, toComplete string) []string {
+	return completeLocalPath(toComplete)
+}
+
+func (c *SyncCommand) Execute(ctx *Context) error {
+	if len(ctx.Args) > 1 {
+		return errors.New("Usage: remote sync [dir]")
+	}
+	if (c.KeepLocal && c.KeepRemote) || (c.KeepLocal && c.Merge) || (c.KeepRemote && c.Merge) {
+		return errors.New("only one of --keep-local, --keep-remote and --merge can be given")
+	}
+	dir := "."
+	if len(ctx.Args) == 1 {
+		dir = ctx.Args[0]
+	}
+	if st, err := os.Stat(dir); err != nil || !st.IsDir() {
+		return fmt.Errorf("Directory not found: %q", dir)
+	}
+	remoteDir := remotePath(ctx.CwdRel, dir)
+	remoteHost, err := ctx.RemoteHost()
+	if err != nil {
+		return err
+	}
+
+	unlock, err := c.Transfer.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stateFile, err := syncStateFile(ctx, remoteHost, dir, remoteDir)
+	if err != nil {
+		return err
+	}
+	state, err := bisync.Load(stateFile)
+	if err != nil {
+		return fmt.Errorf("failed to read sync state: %w", err)
+	}
+	_, span := trace.Start(ctx.Ctx, "local scan")
+	exclude := transferExcludes(ctx, dir)
+	local, err := bisync.HashDir(dir, exclude)
+	span.End()
+	if err != nil {
+		return err
+	}
+	_, span = trace.Start(ctx.Ctx, "remote scan")
+	out, found, err := hashRemoteDir(ctx, remoteHost, remoteDir)
+	span.End()
+	if err != nil {
+		return fmt.Errorf("failed to list remote files: %w", err)
+	}
+	if !found && len(state.Files) > 0 {
+		return fmt.Errorf("%s not found on %s although it was synced before; remove %s to sync from scratch", remoteDir, remoteHost, stateFile)
+	}
+	remote := bisync.ParseHashes(out, exclude)
+
+	changes := bisync.Reconcile(state.Files, local, remote)
+	if conflicts := c.resolve(changes); len(conflicts) > 0 {
+		printConflicts(ctx, remoteHost, conflicts)
+		return fmt.Errorf("sync stopped: %d conflicts", len(conflicts))
+	}
+	if err := c.confirmLocalDeletions(ctx, remoteHost, changes); err != nil {
+		return err
+	}
+	mergeDir := strings.TrimSuffix(stateFile, ".json")
+	if err := c.apply(ctx, remoteHost, dir, remoteDir, mergeDir, changes); err != nil {
+		return err
+	}
+	if ctx.DryRun != DryRunOff {
+		return nil
+	}
+	state.Files = synced(state.Files, local, remote, changes)
+	return state.Save(stateFile)
+}
+
+// resolve turns conflicts into transfers as selected by the flags and
+// returns the conflicts left unresolved.
+func (c *SyncCommand) resolve(changes []bisync.Change) []bisync.Change {
+	var conflicts []bisync.Change
+	for i, ch := range changes {
+		if ch.Action != bisync.Conflict {
+			continue
+		}
+		switch {
+		case c.KeepLocal && ch.Local == bisync.Deleted:
+			changes[i].Action = bisync.DeleteRemote
+		case c.KeepLocal:
+			changes[i].Action = bisync.Push
+		case c.KeepRemote && ch.Remote == bisync.Deleted:
+			changes[i].Action = bisync.DeleteLocal
+		case c.KeepRemote:
+			changes[i].Action = bisync.Pull
+		case c.Merge:
+		default:
+			conflicts = append(conflicts, ch)
+		}
+	}
+	return conflicts
+}
+
+// confirmLocalDeletions lists the local files to delete and asks the user to
+// confirm if there are more than maxLocalDeletions, unless c.Yes is set.
+func (c *SyncCommand) confirmLocalDeletions(ctx *Context, remoteHost string, changes []bisync.Change) error {
+	var deletions []string
+	for _, ch := range changes {
+		if ch.Action == bisync.DeleteLocal {
+			deletions = append(deletions, ch.Path)
+		}
+	}
+	if len(deletions) <= maxLocalDeletions || c.Yes || ctx.DryRun != DryRunOff {
+		return nil
+	}
+	fmt.Fprintf(ctx.Stderr, "The following %d files were deleted on %s and will be deleted locally:\n", len(deletions), remoteHost)
+	for _, path := range deletions {
+		fmt.Fprintf(ctx.Stderr, "  %s\n", path)
+	}
+	ok, err := confirm(ctx, "Delete these files?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("sync cancelled")
+	}
+	return nil
+}
+
+func printConflicts(ctx *Context, remoteHost string, conflicts []bisync.Change) {
+	fmt.Fprintf(ctx.Stderr, "Files changed both locally and on %s since the last sync:\n", remoteHost)
+	for _, ch := range conflicts {
+		fmt.Fprintf(ctx.Stderr, "  %s (local %s, remote %s)\n", ch.Path, ch.Local, ch.Remote)
+	}
+	fmt.Fprint(ctx.Stderr, "Resolve them with one of:\n"+
+		"  remote sync --keep-local   push the local files\n"+
+		"  remote sync --keep-remote  pull the remote files\n"+
+		"  remote sync --merge        download the remote files into the cache dir to merge by hand,\n"+
+		"                             then run remote sync --keep-local\n")
+}
+
+// apply transfers and deletes files as planned by changes. The remote side of
+// conflicts to merge is downloaded into mergeDir, out of the synced tree.
+func (c *SyncCommand) apply(ctx *Context, remoteHost, dir, remoteDir, mergeDir string, changes []bisync.Change) error {
+	var push, pull, delRemote, delLocal, merge []string
+	for _, ch := range changes {
+		switch ch.Action {
+		case bisync.Push:
+			push = append(push, ch.Path)
+		case bisync.Pull:
+			pull = append(pull, ch.Path)
+		case bisync.DeleteRemote:
+			delRemote = append(delRemote, ch.Path)
+		case bisync.DeleteLocal:
+			delLocal = append(delLocal, ch.Path)
+		case bisync.Conflict:
+			if ch.Remote != bisync.Deleted {
+				merge = append(merge, ch.Path)
+			}
+		}
+	}
+
+	localRoot := strings.TrimSuffix(dir, "/") + "/"
+	remoteRoot := fmt.Sprintf("%s:%s/", remoteHost, strings.TrimSuffix(remoteDir, "/"))
+	mode := []string{"-a"}
+	if ctx.IsVerbose {
+		mode = []string{"-av"}
+	}
+	mode = append(mode, c.Transfer.args(ctx.Config)...)
+	shellOpts, err := rsyncShellOptions(ctx, remoteHost)
+	if err != nil {
+		return err
+	}
+	mode = append(mode, shellOpts...)
+	mode = mode[:len(mode):len(mode)] // appended to for each transfer
+	if len(push) > 0 {
+		opts, err := rsyncOptions(ctx, "push", ctx.Passthrough)
+		if err != nil {
+			return err
+		}
+		if err := transferFiles(ctx, push, append(mode, opts...), localRoot, remoteRoot); err != nil {
+			return err
+		}
+	}
+	if len(pull) > 0 {
+		opts, err := rsyncOptions(ctx, "pull", ctx.Passthrough)
+		if err != nil {
+			return err
+		}
+		if err := transferFiles(ctx, pull, append(mode, opts...), remoteRoot, localRoot); err != nil {
+			return err
+		}
+	}
+	for _, p := range merge {
+		src := remoteRoot + p
+		dst := filepath.Join(mergeDir, filepath.FromSlash(p))
+		if ctx.DryRun == DryRunOff {
+			if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+				return err
+			}
+		}
+		if err := executeSubCommand(ctx, "rsync", append(mode, src, dst)); err != nil {
+			return err
+		}
+	}
+	if len(delRemote) > 0 {
+		cmd := fmt.Sprintf("cd %s && rm -f -- %s", shell.Quote(remoteDir), shell.Join(delRemote))
+		opts, err := sshOptions(ctx, remoteHost)
+		if err != nil {
+			return err
+		}
+		if err := executeSubCommand(ctx, "ssh", append(opts, remoteHost, "-T", cmd)); err != nil {
+			return err
+		}
+	}
+	if ctx.DryRun == DryRunOff {
+		for _, p := range delLocal {
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(p))); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	// in dry-run mode stdout is left to the plan
+	w := ctx.Stdout
+	if ctx.DryRun != DryRunOff {
+		w = ctx.Stderr
+	}
+	fmt.Fprintf(w, "%d pushed, %d pulled, %d deleted locally, %d deleted remotely", len(push), len(pull), len(delLocal), len(delRemote))
+	if len(merge) > 0 {
+		fmt.Fprintf(w, ", %d to merge", len(merge))
+	}
+	fmt.Fprintln(w)
+	for _, p := range merge {
+		fmt.Fprintf(w, "  %s\n", filepath.Join(mergeDir, filepath.FromSlash(p)))
+	}
+	return nil
+}
+
+// transferFiles copies files, relative to the src directory, to dst with rsync.
+// The statistics of rsync are only shown in verbose mode.
+func transferFiles(ctx *Context, files, opts []string, src, dst string) error {
+	p := &rsync.Parser{}
+	tctx := *ctx
+	tctx.Stdin = strings.NewReader(strings.Join(files, "\x00"))
+	tctx.Stdout = p
+	if ctx.IsVerbose {
+		tctx.Stdout = io.MultiWriter(ctx.Stdout, p)
+	}
+	err := executeSubCommand(&tctx, "rsync", append(opts, "--stats", "--from0", "--files-from=-", src, dst))
+	p.Close()
+	ctx.addTransferred(p.Stats)
+	return err
+}
+
+// synced returns the hashes both sides share once changes are applied.
+// Unresolved conflicts keep their hash of the previous synchronization.
+func synced(base, local, remote bisync.Hashes, changes []bisync.Change) bisync.Hashes {
+	files := bisync.Hashes{}
+	for p, h := range local {
+		if remote[p] == h {
+			files[p] = h
+		}
+	}
+	for _, ch := range changes {
+		switch ch.Action {
+		case bisync.Push:
+			files[ch.Path] = local[ch.Path]
+		case bisync.Pull:
+			files[ch.Path] = remote[ch.Path]
+		case bisync.Conflict:
+			if h, ok := base[ch.Path]; ok {
+				files[ch.Path] = h
+			}
+		}
+	}
+	return files
+}
+
+// hashRemoteDir returns the output of remoteHashCommand run in remoteDir,
+// and whether remoteDir exists.
+func hashRemoteDir(ctx *Context, remoteHost, remoteDir string) (string, bool, error) {
+	remoteCmd := fmt.Sprintf("cd %s 2>/dev/null || exit %d; %s", shell.Quote(remoteDir), remoteDirMissing, remoteHashCommand)
+	out, err := readRemote(ctx, remoteHost, remoteCmd)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == remoteDirMissing {
+		return "", false, nil
+	}
+	return string(out), err == nil, err
+}
+
+// syncStateFile returns the file keeping the state of synchronizing the
+// local dir with remoteDir on remoteHost.
+func syncStateFile(ctx *Context, remoteHost, dir, remoteDir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(remoteHost + "\x00" + abs + "\x00" + remoteDir))
+	return filepath.Join(ctx.Config.CacheDir, "sync", hex.EncodeToString(sum[:])+".json"), nil
+}
@@ -0,0 +1,217 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yhiraki/remote/internal/bisync"
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// fakeSync puts ssh printing the given remote files as sha256sum does, or
+// failing as for a missing directory if remote is nil, and rsync logging its
+// arguments and stdin, on PATH.
+func fakeSync(t *testing.T, remote map[string]string) (log string) {
+	bin := t.TempDir()
+	log = filepath.Join(bin, "log")
+	var out strings.Builder
+	for name, content := range remote {
+		fmt.Fprintf(&out, "%s  ./%s\n", sha256Hex(content), name)
+	}
+	ssh := fmt.Sprintf("#!/bin/sh\nprintf '%%s' '%s'\n", out.String())
+	if remote == nil {
+		ssh = fmt.Sprintf("#!/bin/sh\nexit %d\n", remoteDirMissing)
+	}
+	scripts := map[string]string{
+		"ssh":   ssh,
+		"rsync": fmt.Sprintf("#!/bin/sh\necho rsync \"$@\" >> %s\ntr '\\0' ' ' >> %s\necho >> %s\n", log, log, log),
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func TestSyncCommand_Execute(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"both.txt": "local edit", "local.txt": "new", "same.txt": "same"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log := fakeSync(t, map[string]string{"both.txt": "remote edit", "remote.txt": "new", "same.txt": "same"})
+
+	cfg := &config.Config{CacheDir: t.TempDir()}
+	newCtx := func() (*Context, *bytes.Buffer, *bytes.Buffer) {
+		var stdout, stderr bytes.Buffer
+		ctx := NewContext(context.Background(), cfg, func() (string, error) { return "example.com", nil }, "proj")
+		ctx.Args = []string{dir}
+		ctx.Stdout = &stdout
+		ctx.Stderr = &stderr
+		return ctx, &stdout, &stderr
+	}
+	stateFile, err := syncStateFile(&Context{Config: cfg}, "example.com", dir, filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&bisync.State{Files: bisync.Hashes{"both.txt": sha256Hex("base")}}).Save(stateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, _, stderr := newCtx()
+	err = (&SyncCommand{}).Execute(ctx)
+	if err == nil || err.Error() != "sync stopped: 1 conflicts" {
+		t.Fatalf("Execute() error = %v, want conflict", err)
+	}
+	if !strings.Contains(stderr.String(), "  both.txt (local modified, remote modified)\n") {
+		t.Errorf("conflict report = %q", stderr.String())
+	}
+	if _, err := os.Stat(log); err == nil {
+		t.Error("files were transferred despite the conflict")
+	}
+
+	ctx, stdout, _ := newCtx()
+	if err := (&SyncCommand{KeepLocal: true}).Execute(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "2 pushed, 1 pulled, 0 deleted locally, 0 deleted remotely\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	transfers, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("rsync -a --stats --from0 --files-from=- %[1]s/ example.com:%[1]s/\nboth.txt local.txt\n", dir) +
+		fmt.Sprintf("rsync -a --stats --from0 --files-from=- example.com:%[1]s/ %[1]s/\nremote.txt\n", dir)
+	if string(transfers) != want {
+		t.Errorf("transfers =\n%s\nwant\n%s", transfers, want)
+	}
+
+	state, err := bisync.Load(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantState := bisync.Hashes{
+		"both.txt":   sha256Hex("local edit"),
+		"local.txt":  sha256Hex("new"),
+		"remote.txt": sha256Hex("new"),
+		"same.txt":   sha256Hex("same"),
+	}
+	if fmt.Sprint(state.Files) != fmt.Sprint(wantState) {
+		t.Errorf("state = %v, want %v", state.Files, wantState)
+	}
+}
+
+func TestSyncCommand_Execute_localDeletions(t *testing.T) {
+	tests := []struct {
+		name    string
+		remote  map[string]string
+		yes     bool
+		answer  string
+		wantErr string
+		kept    int
+	}{
+		{name: "remote dir missing", wantErr: "not found on example.com although it was synced before", kept: maxLocalDeletions + 1},
+		{name: "declined", remote: map[string]string{}, answer: "n\n", wantErr: "sync cancelled", kept: maxLocalDeletions + 1},
+		{name: "confirmed", remote: map[string]string{}, answer: "y\n"},
+		{name: "yes", remote: map[string]string{}, yes: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			base := bisync.Hashes{}
+			for i := 0; i <= maxLocalDeletions; i++ {
+				name := fmt.Sprintf("%d.txt", i)
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				base[name] = sha256Hex(name)
+			}
+			fakeSync(t, tt.remote)
+			cfg := &config.Config{CacheDir: t.TempDir()}
+			stateFile, err := syncStateFile(&Context{Config: cfg}, "example.com", dir, filepath.ToSlash(dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := (&bisync.State{Files: base}).Save(stateFile); err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			ctx := NewContext(context.Background(), cfg, func() (string, error) { return "example.com", nil }, "proj")
+			ctx.Args = []string{dir}
+			ctx.Stdin = strings.NewReader(tt.answer)
+			ctx.Stdout = &stdout
+			ctx.Stderr = &stderr
+			err = (&SyncCommand{Yes: tt.yes}).Execute(ctx)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Execute() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != tt.kept {
+				t.Errorf("%d local files kept, want %d", len(entries), tt.kept)
+			}
+		})
+	}
+}
+
+func TestSyncCommand_Execute_dryRunJSON(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "local.txt"), []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	log := fakeSync(t, map[string]string{"remote.txt": "new"})
+	cfg := &config.Config{CacheDir: t.TempDir()}
+	inv, err := Parse([]string{"--dry-run=json", "sync", dir}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	ctx := NewContext(context.Background(), cfg, func() (string, error) { return "example.com", nil }, "proj")
+	ctx.Stdout = &stdout
+	ctx.Stderr = &stderr
+	if err := inv.Execute(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(stdout.Bytes(), &plan); err != nil {
+		t.Fatalf("stdout is not a JSON plan: %v\n%s", err, stdout.String())
+	}
+	var commands []string
+	for _, step := range plan.Steps {
+		commands = append(commands, step.Command)
+	}
+	if want := []string{"ssh", "rsync", "rsync"}; !reflect.DeepEqual(commands, want) {
+		t.Errorf("plan commands = %q, want %q", commands, want)
+	}
+	if want := "1 pushed, 1 pulled, 0 deleted locally, 0 deleted remotely\n"; stderr.String() != want {
+		t.Errorf("stderr = %q, want %q", stderr.String(), want)
+	}
+	if _, err := os.Stat(log); err == nil {
+		t.Error("files were transferred in dry-run mode")
+	}
+}
@@ -0,0 +1,222 @@
+package command
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func init() {
+	Register(&Spec{
+		Name:    "task",
+		Usage:   "list | run <name> [args...]",
+		Summary: "List or run the aliases and tasks defined in the config file",
+		Examples: []string{
+			"remote task list",
+			"remote task run up",
+			"remote up",
+		},
+		New: func() Command { return &TasksCommand{} },
+	})
+}
+
+// taskSpec returns a spec running the alias or task called name in cfg.
+func taskSpec(name string, cfg *config.Config) (*Spec, bool) {
+	summary := ""
+	if alias, ok := cfg.Aliases[name]; ok {
+		summary = "Alias for: remote " + strings.Join(alias, " ")
+	} else if task, ok := cfg.Tasks[name]; ok {
+		summary = task.Description
+	} else {
+		return nil, false
+	}
+	return &Spec{
+		Name:    name,
+		Usage:   "[args...]",
+		Summary: summary,
+		RawArgs: true,
+		New:     func() Command { return &TaskCommand{Name: name} },
+	}, true
+}
+
+// TaskCommand runs an alias or a task from the config file.
+type TaskCommand struct {
+	Name string
+}
+
+func (c *TaskCommand) SetFlags(fs *flag.FlagSet) {}
+
+func (c *TaskCommand) Execute(ctx *Context) error {
+	r := &taskRunner{ctx: ctx, done: map[string]bool{}}
+	return r.run(c.Name, ctx.Args)
+}
+
+type TasksCommand struct{}
+
+func (c *TasksCommand) SetFlags(fs *flag.FlagSet) {}
+
+func (c *TasksCommand) Execute(ctx *Context) error {
+	if len(ctx.Args) == 0 {
+		return errors.New("Usage: remote task list | run <name> [args...]")
+	}
+	switch ctx.Args[0] {
+	case "list":
+		w := tabwriter.NewWriter(ctx.Stdout, 0, 4, 2, ' ', 0)
+		for _, name := range ctx.Config.TaskNames() {
+			spec, _ := taskSpec(name, ctx.Config)
+			fmt.Fprintf(w, "%s\t%s\n", name, spec.Summary)
+		}
+		return w.Flush()
+	case "run":
+		if len(ctx.Args) < 2 {
+			return errors.New("Usage: remote task run <name> [args...]")
+		}
+		if _, ok := taskSpec(ctx.Args[1], ctx.Config); !ok {
+			return fmt.Errorf("task %q is not defined", ctx.Args[1])
+		}
+		return (&TaskCommand{Name: ctx.Args[1]}).Execute(ctx.withArgs(ctx.Args[2:]))
+	default:
+		return fmt.Errorf("unknown task subcommand %q", ctx.Args[0])
+	}
+}
+
+func (c *TasksCommand) Complete(ctx *Context, args []string, toComplete string) []string {
+	switch {
+	case len(args) == 0:
+		return []string{"list", "run"}
+	case len(args) == 1 && args[0] == "run" && ctx.Config != nil:
+		return ctx.Config.TaskNames()
+	}
+	return nil
+}
+
+// taskRunner runs tasks with their dependencies, each at most once.
+type taskRunner struct {
+	ctx   *Context
+	done  map[string]bool
+	stack []string
+}
+
+func (r *taskRunner) run(name string, args []string) error {
+	for _, n := range r.stack {
+		if n == name {
+			return fmt.Errorf("task %q depends on itself: %s", name, strings.Join(append(r.stack, name), " -> "))
+		}
+	}
+	r.stack = append(r.stack, name)
+	defer func() { r.stack = r.stack[:len(r.stack)-1] }()
+
+	cfg := r.ctx.Config
+	if alias, ok := cfg.Aliases[name]; ok {
+		line, err := expandCommandLine(alias, args, r.ctx, true)
+		if err != nil {
+			return fmt.Errorf("alias %q: %w", name, err)
+		}
+		if err := r.runLine(line); err != nil {
+			return err
+		}
+		r.done[name] = true
+		return nil
+	}
+
+	task, ok := cfg.Tasks[name]
+	if !ok {
+		return fmt.Errorf("task %q is not defined", name)
+	}
+	for _, dep := range task.Deps {
+		if r.done[dep] {
+			continue
+		}
+		if err := r.run(dep, nil); err != nil {
+			return err
+		}
+	}
+	for _, step := range task.Steps {
+		line, err := expandCommandLine(step, args, r.ctx, false)
+		if err != nil {
+			return fmt.Errorf("task %q: %w", name, err)
+		}
+		if err := r.runLine(line); err != nil {
+			return err
+		}
+	}
+	r.done[name] = true
+	return nil
+}
+
+// runLine runs a command line of a task, which may itself name a task.
+func (r *taskRunner) runLine(line []string) error {
+	if err := r.ctx.Ctx.Err(); err != nil {
+		return err
+	}
+	inv, err := Parse(line, r.ctx.Config)
+	if err != nil {
+		return err
+	}
+	if inv.Options != (Options{}) {
+		return fmt.Errorf("global flags are not allowed in tasks: %s", strings.Join(line, " "))
+	}
+	if c, ok := inv.Command.(*TaskCommand); ok {
+		return r.run(c.Name, inv.Args)
+	}
+	ctx := r.ctx.withArgs(inv.Args)
+	ctx.Passthrough = inv.Passthrough
+	return inv.Command.Execute(ctx)
+}
+
+// taskArgs are the arguments given to a task. In templates they print
+// separated by spaces.
+type taskArgs []string
+
+func (a taskArgs) String() string {
+	return strings.Join(a, " ")
+}
+
+// taskData is the data available to templates in task command lines.
+type taskData struct {
+	Args taskArgs
+	ctx  *Context
+}
+
+// Host returns the resolved remote host.
+func (d *taskData) Host() (string, error) {
+	return d.ctx.RemoteHost()
+}
+
+// expandCommandLine substitutes templates in line. An element consisting of
+// {{.Args}} expands to one element per argument. When appendArgs is set and
+// line contains no template, args are appended like for shell aliases.
+func expandCommandLine(line []string, args []string, ctx *Context, appendArgs bool) ([]string, error) {
+	data := &taskData{Args: args, ctx: ctx}
+	expanded := make([]string, 0, len(line)+len(args))
+	hasTemplate := false
+	for _, elem := range line {
+		if !strings.Contains(elem, "{{") {
+			expanded = append(expanded, elem)
+			continue
+		}
+		hasTemplate = true
+		if strings.ReplaceAll(elem, " ", "") == "{{.Args}}" {
+			expanded = append(expanded, args...)
+			continue
+		}
+		tmpl, err := template.New("").Option("missingkey=error").Parse(elem)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, b.String())
+	}
+	if appendArgs && !hasTemplate {
+		expanded = append(expanded, args...)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,186 @@
+package command
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/yhiraki/remote/internal/config"
+)
+
+func TestExpandCommandLine(t *testing.T) {
+	ctx := &Context{
+		resolveHost: func() (string, error) { return "example.com", nil },
+		plan:        &Plan{},
+	}
+
+	tests := []struct {
+		name       string
+		line       []string
+		args       []string
+		appendArgs bool
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name:       "alias appends args",
+			line:       []string{"sh", "docker", "compose", "up"},
+			args:       []string{"-d", "web"},
+			appendArgs: true,
+			want:       []string{"sh", "docker", "compose", "up", "-d", "web"},
+		},
+		{
+			name: "args element expands to each argument",
+			line: []string{"sh", "make", "{{.Args}}", "V=1"},
+			args: []string{"build", "test"},
+			want: []string{"sh", "make", "build", "test", "V=1"},
+		},
+		{
+			name:       "args inside a word are joined",
+			line:       []string{"sh", "echo", "targets: {{.Args}}"},
+			args:       []string{"a", "b"},
+			appendArgs: true,
+			want:       []string{"sh", "echo", "targets: a b"},
+		},
+		{
+			name: "host",
+			line: []string{"sh", "curl", "http://{{.Host}}:8080/"},
+			want: []string{"sh", "curl", "http://example.com:8080/"},
+		},
+		{
+			name: "first argument",
+			line: []string{"pull", "logs/{{index .Args 0}}.log"},
+			args: []string{"app"},
+			want: []string{"pull", "logs/app.log"},
+		},
+		{
+			name:    "unknown field",
+			line:    []string{"sh", "{{.Unknown}}"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandCommandLine(tt.line, tt.args, ctx, tt.appendArgs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expandCommandLine() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandCommandLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaskCommand_Execute(t *testing.T) {
+	cfg := &config.Config{
+		Aliases: map[string]config.CommandLine{
+			"logs": {"sh", "tail", "-f"},
+		},
+		Tasks: map[string]*config.Task{
+			"up": {
+				Description: "start services",
+				Deps:        []string{"build", "web"},
+				Steps:       []config.CommandLine{{"sh", "docker", "compose", "up", "{{.Args}}"}},
+			},
+			"build": {Steps: []config.CommandLine{{"sh", "make"}}},
+			"web":   {Deps: []string{"build"}, Steps: []config.CommandLine{{"tunnel", "--background", "8080"}}},
+			"loop":  {Steps: []config.CommandLine{{"loop2"}}},
+			"loop2": {Deps: []string{"loop"}},
+			"bad":   {Steps: []config.CommandLine{{"--dry-run", "sh", "ls"}}},
+			"ship":  {Steps: []config.CommandLine{{"push", ".", "--", "--checksum"}, {"push", "."}}},
+		},
+	}
+	newContext := func(args []string) *Context {
+		return &Context{
+			Ctx:         context.Background(),
+			Config:      cfg,
+			Args:        args,
+			DryRun:      DryRunText,
+			CwdRel:      "src",
+			resolveHost: func() (string, error) { return "example.com", nil },
+			plan:        &Plan{},
+		}
+	}
+
+	t.Run("dependencies run once and in order", func(t *testing.T) {
+		ctx := newContext([]string{"-d"})
+		if err := (&TaskCommand{Name: "up"}).Execute(ctx); err != nil {
+			t.Fatalf("TaskCommand.Execute() error = %v", err)
+		}
+		var got [][]string
+		for _, step := range ctx.plan.Steps {
+			got = append(got, append([]string{step.Command}, step.Args...))
+		}
+		want := [][]string{
+			{"ssh", "example.com", "-T", "cd src; exec make"},
+			{"ssh", "-N", "-f", "-L", "8080:localhost:8080", "example.com"},
+			{"ssh", "example.com", "-T", "cd src; exec docker compose up -d"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("planned steps = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("alias", func(t *testing.T) {
+		ctx := newContext([]string{"app.log"})
+		if err := (&TaskCommand{Name: "logs"}).Execute(ctx); err != nil {
+			t.Fatalf("TaskCommand.Execute() error = %v", err)
+		}
+		if len(ctx.plan.Steps) != 1 || ctx.plan.Steps[0].Args[2] != "cd src; exec tail -f app.log" {
+			t.Errorf("planned steps = %v", ctx.plan.Steps)
+		}
+	})
+
+	t.Run("passthrough", func(t *testing.T) {
+		ctx := newContext(nil)
+		ctx.Passthrough = []string{"--compress"}
+		if err := (&TaskCommand{Name: "ship"}).Execute(ctx); err != nil {
+			t.Fatalf("TaskCommand.Execute() error = %v", err)
+		}
+		if len(ctx.plan.Steps) != 2 {
+			t.Fatalf("planned steps = %v, want 2", ctx.plan.Steps)
+		}
+		for i, want := range [][]string{{"--checksum"}, nil} {
+			var got []string
+			for _, arg := range ctx.plan.Steps[i].Args {
+				if arg == "--checksum" || arg == "--compress" {
+					got = append(got, arg)
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("step %d passes %q to rsync, want %q", i, got, want)
+			}
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		if err := (&TaskCommand{Name: "loop"}).Execute(newContext(nil)); err == nil {
+			t.Error("TaskCommand.Execute() expected error for cyclic task, got nil")
+		}
+	})
+
+	t.Run("global flags in steps", func(t *testing.T) {
+		if err := (&TaskCommand{Name: "bad"}).Execute(newContext(nil)); err == nil {
+			t.Error("TaskCommand.Execute() expected error for global flag in step, got nil")
+		}
+	})
+
+	t.Run("lookup falls back to tasks", func(t *testing.T) {
+		inv, err := Parse([]string{"up", "-d", "--dry-run", "--", "--verbose"}, cfg)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if c, ok := inv.Command.(*TaskCommand); !ok || c.Name != "up" {
+			t.Errorf("Parse() command = %#v, want task up", inv.Command)
+		}
+		if !reflect.DeepEqual(inv.Args, []string{"-d", "--verbose"}) {
+			t.Errorf("Parse() args = %v, want [-d --verbose]", inv.Args)
+		}
+		if inv.Options != (Options{DryRun: DryRunText}) {
+			t.Errorf("Parse() options = %+v, want dry run", inv.Options)
+		}
+	})
+}
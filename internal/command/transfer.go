@@ -0,0 +1,117 @@
+package command
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yhiraki/remote/internal/config"
+	"github.com/yhiraki/remote/internal/lock"
+)
+
+// transferLockFile is the lock file in CacheDir serializing the transfers of
+// a project.
+const transferLockFile = "transfer.lock"
+
+// TransferOptions holds the flags shared by the commands transferring files.
+type TransferOptions struct {
+	BwLimit string
+	// NoWait fails instead of waiting when another transfer of the project runs.
+	NoWait bool
+}
+
+func (o *TransferOptions) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.BwLimit, "bwlimit", "", "limit the bandwidth in KiB/s, or with a unit such as 1.5m (0 for no limit; default from the config)")
+	fs.Var(negatedFlag{&o.NoWait}, "wait", "wait for the other transfers of the project to finish first (default)")
+	fs.BoolVar(&o.NoWait, "no-wait", o.NoWait, "fail if another transfer of the project is running")
+}
+
+// args returns the rsync options implementing o, with the bandwidth limit of
+// cfg by default.
+func (o *TransferOptions) args(cfg *config.Config) []string {
+	bw := o.BwLimit
+	if bw == "" {
+		bw = string(cfg.BwLimit)
+	}
+	if bw == "" {
+		return nil
+	}
+	return []string{"--bwlimit=" + bw}
+}
+
+// lock acquires the transfer lock of the project, waiting for the transfer
+// holding it unless o.NoWait is set, and returns the function releasing it.
+func (o *TransferOptions) lock(ctx *Context) (unlock func(), err error) {
+	if ctx.DryRun != DryRunOff {
+		return func() {}, nil
+	}
+	if err := os.MkdirAll(ctx.Config.CacheDir, 0o705); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(ctx.Config.CacheDir, transferLockFile)
+	var l *lock.Lock
+	if o.NoWait {
+		l, err = lock.TryLock(path)
+		if errors.Is(err, lock.ErrLocked) {
+			h, _ := lock.ReadHolder(path)
+			return nil, fmt.Errorf("another transfer of this project is running (%s); retry later or use --wait", h)
+		}
+	} else {
+		l, err = lock.Acquire(ctx.Ctx, path, func(h lock.Holder) {
+			fmt.Fprintf(ctx.Stderr, "Waiting for another transfer of this project to finish (%s)...\n", h)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() { l.Unlock() }, nil
+}
+
+// transferExcludes returns the patterns excluding files under dir from a
+// transfer: those of the config and the cache dir, which holds the state of
+// remote such as the transfer lock and the known hosts, if it lies under dir.
+func transferExcludes(ctx *Context, dir string) []string {
+	exclude := ctx.Config.ExcludeFiles
+	if ctx.Config.CacheDir == "" {
+		return exclude
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return exclude
+	}
+	absCache, err := filepath.Abs(ctx.Config.CacheDir)
+	if err != nil {
+		return exclude
+	}
+	rel, err := filepath.Rel(absDir, absCache)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return exclude
+	}
+	return append(exclude[:len(exclude):len(exclude)], "/"+filepath.ToSlash(rel)+"/")
+}
+
+// negatedFlag is a boolean flag.Value setting the negation of its value to p.
+type negatedFlag struct {
+	p *bool
+}
+
+func (f negatedFlag) String() string {
+	return strconv.FormatBool(f.p != nil && !*f.p)
+}
+
+func (f negatedFlag) Set(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*f.p = !v
+	return nil
+}
+
+func (f negatedFlag) IsBoolFlag() bool {
+	return true
+}
@@ -0,0 +1,107 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yhiraki/remote/internal/config"
+	"github.com/yhiraki/remote/internal/lock"
+)
+
+func TestTransferOptions_args(t *testing.T) {
+	tests := []struct {
+		name string
+		flag string
+		cfg  config.Rate
+		want []string
+	}{
+		{name: "none"},
+		{name: "config", cfg: "1000", want: []string{"--bwlimit=1000"}},
+		{name: "flag overrides config", flag: "1.5m", cfg: "1000", want: []string{"--bwlimit=1.5m"}},
+		{name: "no limit", flag: "0", cfg: "1000", want: []string{"--bwlimit=0"}},
+	}
+
+	for _, tt := range tests {
+		o := &TransferOptions{BwLimit: tt.flag}
+		if got := o.args(&config.Config{BwLimit: tt.cfg}); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: TransferOptions.args() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTransferOptions_lock(t *testing.T) {
+	cfg := &config.Config{CacheDir: t.TempDir()}
+	held, err := lock.TryLock(filepath.Join(cfg.CacheDir, transferLockFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Unlock()
+
+	c, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var stderr bytes.Buffer
+	ctx := NewContext(c, cfg, nil, ".")
+	ctx.Stderr = &stderr
+
+	if _, err := (&TransferOptions{NoWait: true}).lock(ctx); err == nil || !strings.HasPrefix(err.Error(), "another transfer of this project is running (pid ") {
+		t.Errorf("lock() with --no-wait error = %v, want the holder named", err)
+	}
+	if _, err := (&TransferOptions{}).lock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("lock() of a held lock error = %v, want deadline exceeded", err)
+	}
+	if !strings.HasPrefix(stderr.String(), "Waiting for another transfer of this project to finish (pid ") {
+		t.Errorf("stderr = %q, want a waiting message", stderr.String())
+	}
+
+	held.Unlock()
+	unlock, err := (&TransferOptions{NoWait: true}).lock(ctx)
+	if err != nil {
+		t.Fatalf("lock() of a free lock error = %v", err)
+	}
+	unlock()
+}
+
+func TestTransferOptions_SetFlags(t *testing.T) {
+	for args, want := range map[string]bool{"": false, "--no-wait": true, "--no-wait --wait": false, "--wait=false": true} {
+		var o TransferOptions
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		o.SetFlags(fs)
+		if err := fs.Parse(strings.Fields(args)); err != nil {
+			t.Fatal(err)
+		}
+		if o.NoWait != want {
+			t.Errorf("%q: NoWait = %v, want %v", args, o.NoWait, want)
+		}
+	}
+}
+
+func TestTransferExcludes(t *testing.T) {
+	tests := []struct {
+		name     string
+		cacheDir string
+		dir      string
+		want     []string
+	}{
+		{name: "project cache dir", cacheDir: "/proj/.remote", dir: "/proj", want: []string{"*.o", "/.remote/"}},
+		{name: "nested", cacheDir: "/proj/.remote", dir: "/", want: []string{"*.o", "/proj/.remote/"}},
+		{name: "outside", cacheDir: "/home/user/.cache/remote", dir: "/proj", want: []string{"*.o"}},
+		{name: "sibling", cacheDir: "/proj/.remote", dir: "/proj/src", want: []string{"*.o"}},
+		{name: "no cache dir", dir: "/proj", want: []string{"*.o"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &Context{Config: &config.Config{CacheDir: filepath.FromSlash(tt.cacheDir), ExcludeFiles: []string{"*.o"}}}
+			if got := transferExcludes(ctx, filepath.FromSlash(tt.dir)); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("transferExcludes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
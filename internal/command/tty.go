@@ -0,0 +1,64 @@
+package command
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/yhiraki/remote/internal/term"
+)
+
+// TTYMode controls pseudo-terminal allocation on the remote host.
+type TTYMode int
+
+const (
+	// TTYAuto allocates a pty only when local stdin and stdout are terminals.
+	TTYAuto TTYMode = iota
+	TTYForce
+	TTYDisable
+)
+
+// wantTTY reports whether a pty should be requested for a remote command
+// connected to stdin and stdout.
+func (m TTYMode) wantTTY(stdin io.Reader, stdout io.Writer) bool {
+	switch m {
+	case TTYForce:
+		return true
+	case TTYDisable:
+		return false
+	default:
+		in, ok := stdin.(*os.File)
+		if !ok {
+			return false
+		}
+		out, ok := stdout.(*os.File)
+		return ok && term.IsTerminal(in) && term.IsTerminal(out)
+	}
+}
+
+// TTYFlag is a boolean flag.Value that sets Mode to Value when given.
+type TTYFlag struct {
+	Mode  *TTYMode
+	Value TTYMode
+}
+
+func (f TTYFlag) String() string {
+	return strconv.FormatBool(f.Mode != nil && *f.Mode == f.Value)
+}
+
+func (f TTYFlag) Set(value string) error {
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	if on {
+		*f.Mode = f.Value
+	} else if *f.Mode == f.Value {
+		*f.Mode = TTYAuto
+	}
+	return nil
+}
+
+func (f TTYFlag) IsBoolFlag() bool {
+	return true
+}
@@ -0,0 +1,56 @@
+package command
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTTYFlag(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want TTYMode
+	}{
+		{name: "default", args: []string{}, want: TTYAuto},
+		{name: "force", args: []string{"-t"}, want: TTYForce},
+		{name: "force long", args: []string{"--tty"}, want: TTYForce},
+		{name: "disable", args: []string{"-T"}, want: TTYDisable},
+		{name: "disable long", args: []string{"--no-tty"}, want: TTYDisable},
+		{name: "last wins", args: []string{"-T", "-t"}, want: TTYForce},
+		{name: "explicit false", args: []string{"-t", "--tty=false"}, want: TTYAuto},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mode TTYMode
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			for _, name := range []string{"t", "tty"} {
+				fs.Var(TTYFlag{Mode: &mode, Value: TTYForce}, name, "")
+			}
+			for _, name := range []string{"T", "no-tty"} {
+				fs.Var(TTYFlag{Mode: &mode, Value: TTYDisable}, name, "")
+			}
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if mode != tt.want {
+				t.Errorf("TTYMode = %v, want %v", mode, tt.want)
+			}
+		})
+	}
+}
+
+func TestTTYMode_wantTTY(t *testing.T) {
+	if !TTYForce.wantTTY(nil, nil) {
+		t.Error("TTYForce.wantTTY() = false, want true")
+	}
+	if TTYDisable.wantTTY(nil, nil) {
+		t.Error("TTYDisable.wantTTY() = true, want false")
+	}
+	if TTYAuto.wantTTY(strings.NewReader(""), &strings.Builder{}) {
+		t.Error("TTYAuto.wantTTY() = true for non-file streams, want false")
+	}
+}
@@ -2,23 +2,71 @@ package command
 
 import (
 	"errors"
+	"flag"
 	"fmt"
-	"log"
+
+	"github.com/yhiraki/remote/internal/config"
 )
 
-type TunnelCommand struct{}
+func init() {
+	Register(&Spec{
+		Name:         "tunnel",
+		Usage:        "<port|name> [port|name]...",
+		Summary:      "Forward local ports, or the ports of named tunnels, to the same ports on the remote host",
+		Examples:     []string{"remote tunnel 8080", "remote tunnel --background 8080 3000", "remote tunnel web"},
+		Interspersed: true,
+		New:          func() Command { return &TunnelCommand{} },
+	})
+}
+
+type TunnelCommand struct {
+	IsBackground bool
+}
+
+func (c *TunnelCommand) SetFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.IsBackground, "background", false, "run tunnel in background")
+}
 
 func (c *TunnelCommand) Execute(ctx *Context) error {
-	cmdName, cmdArgs, err := c.build(ctx.RemoteHost, ctx.Args, ctx.IsBackground, ctx.IsVerbose)
+	remoteHost, err := ctx.RemoteHost()
+	if err != nil {
+		return err
+	}
+	ports := expandTunnels(ctx.Config.Tunnels, ctx.Args)
+	cmdName, cmdArgs, err := c.build(remoteHost, ports, c.IsBackground)
+	if err != nil {
+		return err
+	}
+	opts, err := sshOptions(ctx, remoteHost)
 	if err != nil {
 		return err
 	}
-	return executeSubCommand(cmdName, cmdArgs, ctx.IsDryRun)
+	return executeSubCommand(ctx, cmdName, append(opts, cmdArgs...))
+}
+
+func (c *TunnelCommand) Complete(ctx *Context, args []string, toComplete string) []string {
+	if ctx.Config == nil {
+		return nil
+	}
+	return ctx.Config.TunnelNames()
 }
 
-func (c *TunnelCommand) build(remoteHost string, subCmdArgs []string, isBackground, isVerbose bool) (string, []string, error) {
+// expandTunnels replaces the names of tunnel profiles in args with their ports.
+func expandTunnels(tunnels map[string]config.Ports, args []string) []string {
+	ports := make([]string, 0, len(args))
+	for _, arg := range args {
+		if p, ok := tunnels[arg]; ok {
+			ports = append(ports, p...)
+		} else {
+			ports = append(ports, arg)
+		}
+	}
+	return ports
+}
+
+func (c *TunnelCommand) build(remoteHost string, subCmdArgs []string, isBackground bool) (string, []string, error) {
 	if len(subCmdArgs) == 0 {
-		return "", nil, errors.New("Usage: remote tunnel <port1> [port2]...")
+		return "", nil, errors.New("Usage: remote tunnel <port|name> [port|name]...")
 	}
 	sshArgs := []string{"-N"}
 	if isBackground {
@@ -28,9 +76,5 @@ func (c *TunnelCommand) build(remoteHost string, subCmdArgs []string, isBackgrou
 		sshArgs = append(sshArgs, "-L", fmt.Sprintf("%s:localhost:%s", port, port))
 	}
 	sshArgs = append(sshArgs, remoteHost)
-	if isVerbose {
-		log.Printf("[DEBUG] Executing SSH tunnel command: %s %v", "ssh", sshArgs)
-	}
 	return "ssh", sshArgs, nil
 }
-
@@ -3,6 +3,8 @@ package command
 import (
 	"reflect"
 	"testing"
+
+	"github.com/yhiraki/remote/internal/config"
 )
 
 func TestTunnelCommand_build(t *testing.T) {
@@ -11,7 +13,6 @@ func TestTunnelCommand_build(t *testing.T) {
 		remoteHost   string
 		subCmdArgs   []string
 		isBackground bool
-		isVerbose    bool
 		wantCmd      string
 		wantArgs     []string
 		wantErr      bool
@@ -21,7 +22,6 @@ func TestTunnelCommand_build(t *testing.T) {
 			remoteHost:   "example.com",
 			subCmdArgs:   []string{"8080"},
 			isBackground: false,
-			isVerbose:    false,
 			wantCmd:      "ssh",
 			wantArgs:     []string{"-N", "-L", "8080:localhost:8080", "example.com"},
 			wantErr:      false,
@@ -31,7 +31,6 @@ func TestTunnelCommand_build(t *testing.T) {
 			remoteHost:   "example.com",
 			subCmdArgs:   []string{"8080", "3000"},
 			isBackground: false,
-			isVerbose:    false,
 			wantCmd:      "ssh",
 			wantArgs:     []string{"-N", "-L", "8080:localhost:8080", "-L", "3000:localhost:3000", "example.com"},
 			wantErr:      false,
@@ -41,7 +40,6 @@ func TestTunnelCommand_build(t *testing.T) {
 			remoteHost:   "example.com",
 			subCmdArgs:   []string{"8080"},
 			isBackground: true,
-			isVerbose:    false,
 			wantCmd:      "ssh",
 			wantArgs:     []string{"-N", "-f", "-L", "8080:localhost:8080", "example.com"},
 			wantErr:      false,
@@ -51,7 +49,6 @@ func TestTunnelCommand_build(t *testing.T) {
 			remoteHost:   "example.com",
 			subCmdArgs:   []string{},
 			isBackground: false,
-			isVerbose:    false,
 			wantErr:      true,
 		},
 	}
@@ -59,7 +56,7 @@ func TestTunnelCommand_build(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			c := &TunnelCommand{}
-			gotCmd, gotArgs, err := c.build(tt.remoteHost, tt.subCmdArgs, tt.isBackground, tt.isVerbose)
+			gotCmd, gotArgs, err := c.build(tt.remoteHost, tt.subCmdArgs, tt.isBackground)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TunnelCommand.build() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -76,3 +73,14 @@ func TestTunnelCommand_build(t *testing.T) {
 	}
 }
 
+func TestExpandTunnels(t *testing.T) {
+	tunnels := map[string]config.Ports{
+		"web": {"8080", "3000"},
+		"db":  {"5432"},
+	}
+	got := expandTunnels(tunnels, []string{"web", "9000", "db"})
+	want := []string{"8080", "3000", "9000", "5432"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandTunnels() = %v, want %v", got, want)
+	}
+}
@@ -3,18 +3,137 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/yhiraki/remote/internal/shell"
 )
 
 type Config struct {
-	Hostname           string   `json:"hostname"`
-	HostnameCommand    string   `json:"hostnameCommand"`
-	ExcludeFiles       []string `json:"excludeFiles"`
-	ConfigDir          string   `json:"configDir"`
-	CacheDir           string   `json:"cacheDir"`
-	CacheExpireMinutes int      `json:"cacheExpireMinutes"`
-	StartupWaitSeconds int      `json:"startupWaitSeconds"`
+	Hostname           string                 `json:"hostname"`
+	HostnameCommand    string                 `json:"hostnameCommand"`
+	HostKeyPolicy      string                 `json:"hostKeyPolicy"`
+	HostKeyCommand     string                 `json:"hostKeyCommand"`
+	ExcludeFiles       []string               `json:"excludeFiles"`
+	EnvFile            string                 `json:"envFile"`
+	EnvTransport       string                 `json:"envTransport"`
+	Mirror             bool                   `json:"mirror"`
+	ProtectPaths       []string               `json:"protectPaths"`
+	RsyncOptions       []string               `json:"rsyncOptions"`
+	PushOptions        []string               `json:"pushOptions"`
+	PullOptions        []string               `json:"pullOptions"`
+	BwLimit            Rate                   `json:"bwlimit"`
+	ConfigDir          string                 `json:"configDir"`
+	CacheDir           string                 `json:"cacheDir"`
+	CacheExpireMinutes int                    `json:"cacheExpireMinutes"`
+	StartupWaitSeconds int                    `json:"startupWaitSeconds"`
+	Hosts              map[string]*Host       `json:"hosts"`
+	Tunnels            map[string]Ports       `json:"tunnels"`
+	Aliases            map[string]CommandLine `json:"aliases"`
+	Tasks              map[string]*Task       `json:"tasks"`
+	AuditLog           AuditLog               `json:"auditLog"`
+
+	// Source is the path of the config file that was loaded.
+	Source string `json:"-"`
+	// Profile is the name of the host profile selected by UseHost.
+	Profile string `json:"-"`
+}
+
+// Host is a named host profile overriding the top-level host settings.
+type Host struct {
+	Hostname           string `json:"hostname"`
+	HostnameCommand    string `json:"hostnameCommand"`
+	HostKeyPolicy      string `json:"hostKeyPolicy"`
+	HostKeyCommand     string `json:"hostKeyCommand"`
+	CacheExpireMinutes int    `json:"cacheExpireMinutes"`
+	BwLimit            Rate   `json:"bwlimit"`
+}
+
+// AuditLog configures the log of the invocations of remote.
+type AuditLog struct {
+	Disabled bool `json:"disabled"`
+	// File defaults to audit.log in the cache dir of the user, out of the
+	// project. A relative path is relative to the directory of the config
+	// file.
+	File      string `json:"file"`
+	MaxSizeKB int    `json:"maxSizeKB"`
+	MaxFiles  int    `json:"maxFiles"`
+}
+
+// Ports is a list of port numbers, written in JSON as numbers or strings.
+type Ports []string
+
+// Rate is a bandwidth limit in the format of rsync --bwlimit, such as "1.5m",
+// written in JSON as a string or as a number of KiB per second.
+type Rate string
+
+// Task is a named sequence of remote command lines.
+type Task struct {
+	Description string        `json:"description"`
+	Deps        []string      `json:"deps"`
+	Steps       []CommandLine `json:"steps"`
+}
+
+// CommandLine is a remote command line, written in JSON either as a list of
+// arguments or as a string split into words like a shell does.
+type CommandLine []string
+
+func (c *CommandLine) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var args []string
+		if err := json.Unmarshal(data, &args); err != nil {
+			return errors.New("command line must be a string or a list of strings")
+		}
+		*c = args
+		return nil
+	}
+	args, err := shell.Split(s)
+	if err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		*r = Rate(strconv.FormatFloat(v, 'f', -1, 64))
+	case string:
+		*r = Rate(v)
+	default:
+		return fmt.Errorf("invalid bandwidth limit %v", v)
+	}
+	return nil
+}
+
+func (p *Ports) UnmarshalJSON(data []byte) error {
+	var values []interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	ports := make(Ports, 0, len(values))
+	for _, v := range values {
+		switch v := v.(type) {
+		case float64:
+			ports = append(ports, strconv.Itoa(int(v)))
+		case string:
+			ports = append(ports, v)
+		default:
+			return fmt.Errorf("invalid port %v", v)
+		}
+	}
+	*p = ports
+	return nil
 }
 
 func New() (*Config, error) {
@@ -31,6 +150,11 @@ func New() (*Config, error) {
 		CacheDir:           filepath.Join(home, ".cache", "remote"),
 		CacheExpireMinutes: 12 * 60,
 		StartupWaitSeconds: 20,
+		AuditLog: AuditLog{
+			File:      filepath.Join(home, ".cache", "remote", "audit.log"),
+			MaxSizeKB: 1024,
+			MaxFiles:  3,
+		},
 	}, nil
 }
 
@@ -38,6 +162,7 @@ func New() (*Config, error) {
 func (c *Config) Load(fileName string) error {
 	configFile, err := findConfigFile(fileName)
 	if err == nil {
+		slog.Debug("project config found", "file", configFile)
 		// project local config found
 		// Adjust ConfigDir and CacheDir based on found config file location
 		c.ConfigDir = filepath.Dir(configFile)
@@ -45,11 +170,113 @@ func (c *Config) Load(fileName string) error {
 	} else {
 		// user global config
 		configFile = filepath.Join(c.ConfigDir, fileName)
+		slog.Debug("no project config, using the user config", "file", configFile)
 	}
+	c.Source = configFile
 
 	return parseConfigJson(configFile, c)
 }
 
+// UseHost applies the settings of the named host profile.
+func (c *Config) UseHost(name string) error {
+	h, ok := c.Hosts[name]
+	if !ok {
+		return fmt.Errorf("host %q is not defined in %s", name, c.Source)
+	}
+	c.Hostname = h.Hostname
+	c.HostnameCommand = h.HostnameCommand
+	if h.CacheExpireMinutes > 0 {
+		c.CacheExpireMinutes = h.CacheExpireMinutes
+	}
+	if h.BwLimit != "" {
+		c.BwLimit = h.BwLimit
+	}
+	if h.HostKeyPolicy != "" {
+		c.HostKeyPolicy = h.HostKeyPolicy
+	}
+	if h.HostKeyCommand != "" {
+		c.HostKeyCommand = h.HostKeyCommand
+	}
+	c.Profile = name
+	slog.Debug("using host profile", "name", name)
+	return nil
+}
+
+// HostNames returns the names of the host profiles in sorted order.
+func (c *Config) HostNames() []string {
+	names := make([]string, 0, len(c.Hosts))
+	for name := range c.Hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TunnelNames returns the names of the tunnel profiles in sorted order.
+func (c *Config) TunnelNames() []string {
+	names := make([]string, 0, len(c.Tunnels))
+	for name := range c.Tunnels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TaskNames returns the names of the aliases and tasks in sorted order.
+func (c *Config) TaskNames() []string {
+	names := make([]string, 0, len(c.Aliases)+len(c.Tasks))
+	for name := range c.Aliases {
+		names = append(names, name)
+	}
+	for name := range c.Tasks {
+		if _, ok := c.Aliases[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HostnameCacheFile returns the file caching the output of HostnameCommand.
+func (c *Config) HostnameCacheFile() string {
+	if c.Profile == "" {
+		return filepath.Join(c.CacheDir, "hostname")
+	}
+	return filepath.Join(c.CacheDir, "hostname-"+c.Profile)
+}
+
+// AuditLogFile returns the file of the audit log, audit.log in CacheDir if
+// AuditLog.File is not set as by New.
+func (c *Config) AuditLogFile() string {
+	f := c.AuditLog.File
+	switch {
+	case f == "":
+		return filepath.Join(c.CacheDir, "audit.log")
+	case filepath.IsAbs(f) || c.Source == "":
+		return f
+	}
+	return filepath.Join(filepath.Dir(c.Source), f)
+}
+
+// KnownHostsFile returns the known_hosts file of the selected host profile,
+// used unless HostKeyPolicy is empty. It is kept in CacheDir, which is never
+// transferred, rather than in the project.
+func (c *Config) KnownHostsFile() string {
+	if c.Profile == "" {
+		return filepath.Join(c.CacheDir, "known_hosts")
+	}
+	return filepath.Join(c.CacheDir, "known_hosts-"+c.Profile)
+}
+
+// HostKeyAlias returns the name of the remote host in KnownHostsFile for the
+// host key policies independent of its address.
+func (c *Config) HostKeyAlias() string {
+	if c.Profile == "" {
+		return "remote"
+	}
+	return "remote-" + c.Profile
+}
+
 func findConfigFile(name string) (string, error) {
 	cwd, err := os.Getwd()
 	if err != nil {
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -53,6 +55,12 @@ func TestConfig_Load(t *testing.T) {
 		if !reflect.DeepEqual(cfg.ExcludeFiles, []string{"*.log"}) {
 			t.Errorf("Config.ExcludeFiles = %v, want %v", cfg.ExcludeFiles, []string{"*.log"})
 		}
+		if filepath.Base(cfg.Source) != configName {
+			t.Errorf("Config.Source = %v, want a path to %v", cfg.Source, configName)
+		}
+		if strings.HasPrefix(cfg.AuditLogFile(), cfg.ConfigDir) {
+			t.Errorf("Config.AuditLogFile() = %v, want it out of the project", cfg.AuditLogFile())
+		}
 	})
 
 	t.Run("config not found", func(t *testing.T) {
@@ -67,7 +75,7 @@ func TestConfig_Load(t *testing.T) {
 		// we will focus on the fact that local config is missing.
 		// However, Load implementation falls back to global config.
 		// If global config doesn't exist, Open fails.
-		
+
 		// For this test, we assume global config at ~/.config/remote/.remoterc.json likely doesn't exist or we can't control it.
 		// So we expect an error.
 		if err := cfg.Load("nonexistent.json"); err == nil {
@@ -90,3 +98,77 @@ func TestConfig_Load(t *testing.T) {
 	})
 }
 
+func TestConfig_UseHost(t *testing.T) {
+	cfg, err := New()
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	content := `{
+		"hostname": "default.example.com",
+		"bwlimit": 1000,
+		"hostKeyPolicy": "strict",
+		"hosts": {
+			"dev": {"hostnameCommand": "echo dev.example.com", "cacheExpireMinutes": 5, "bwlimit": "1.5m", "hostKeyPolicy": "tofu"},
+			"prod": {"hostname": "prod.example.com"}
+		},
+		"tunnels": {"web": [8080, "3000"]}
+	}`
+	if err := json.Unmarshal([]byte(content), cfg); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(cfg.Tunnels["web"], Ports{"8080", "3000"}) {
+		t.Errorf("Config.Tunnels[web] = %v, want %v", cfg.Tunnels["web"], Ports{"8080", "3000"})
+	}
+	if cfg.BwLimit != "1000" {
+		t.Errorf("Config.BwLimit = %q, want 1000", cfg.BwLimit)
+	}
+	if !reflect.DeepEqual(cfg.HostNames(), []string{"dev", "prod"}) {
+		t.Errorf("Config.HostNames() = %v, want %v", cfg.HostNames(), []string{"dev", "prod"})
+	}
+
+	if err := cfg.UseHost("dev"); err != nil {
+		t.Fatalf("Config.UseHost() error = %v", err)
+	}
+	if cfg.Hostname != "" || cfg.HostnameCommand != "echo dev.example.com" || cfg.CacheExpireMinutes != 5 || cfg.BwLimit != "1.5m" {
+		t.Errorf("Config.UseHost() = %+v, want settings of dev", cfg)
+	}
+	if filepath.Base(cfg.HostnameCacheFile()) != "hostname-dev" {
+		t.Errorf("Config.HostnameCacheFile() = %v, want hostname-dev", cfg.HostnameCacheFile())
+	}
+	if cfg.HostKeyPolicy != "tofu" || cfg.KnownHostsFile() != filepath.Join(cfg.CacheDir, "known_hosts-dev") || cfg.HostKeyAlias() != "remote-dev" {
+		t.Errorf("Config.UseHost() host key settings = %q, %v, %v", cfg.HostKeyPolicy, cfg.KnownHostsFile(), cfg.HostKeyAlias())
+	}
+
+	if err := cfg.UseHost("unknown"); err == nil {
+		t.Error("Config.UseHost() expected error for unknown host, got nil")
+	}
+}
+
+func TestCommandLine_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    CommandLine
+		wantErr bool
+	}{
+		{name: "string", in: `"sh docker compose -f 'dev env.yml' up"`, want: CommandLine{"sh", "docker", "compose", "-f", "dev env.yml", "up"}},
+		{name: "list", in: `["sh", "echo", "a b"]`, want: CommandLine{"sh", "echo", "a b"}},
+		{name: "unterminated quote", in: `"sh echo 'a"`, wantErr: true},
+		{name: "number", in: `1`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got CommandLine
+			err := json.Unmarshal([]byte(tt.in), &got)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CommandLine.UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CommandLine.UnmarshalJSON() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
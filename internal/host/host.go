@@ -1,65 +1,48 @@
 package host
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"os"
 	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/yhiraki/remote/internal/atomicfile"
+	"github.com/yhiraki/remote/internal/lock"
+	"github.com/yhiraki/remote/internal/trace"
 )
 
 // Get resolves the remote hostname, utilizing a cache file to minimize command execution.
-func Get(
-	cmd string, cacheFile string, cacheExpireMinutes int, isVerbose bool,
-) (string, error) {
-	timeBeforeCacheExpires := time.Duration(cacheExpireMinutes) * time.Minute
-
-	if isVerbose {
-		log.Printf("[DEBUG] Checking cache file: %s", cacheFile)
+func Get(ctx context.Context, cmd string, cacheFile string, cacheExpireMinutes int) (string, error) {
+	ctx, span := trace.Start(ctx, "host resolution")
+	defer span.End()
+	if host, ok := readCache(cacheFile, cacheExpireMinutes); ok {
+		span.SetAttr("cache", "hit")
+		return host, nil
 	}
+	span.SetAttr("cache", "miss")
 
-	// First, try to read from a valid cache
-	cacheFileState, err := os.Stat(cacheFile)
-	if err == nil { // Cache file exists
-		if isVerbose {
-			log.Printf("[DEBUG] Cache file found. Checking expiration...")
-		}
-		isCacheExpired := cacheFileState.ModTime().Add(timeBeforeCacheExpires).Before(time.Now())
-		if !isCacheExpired {
-			if isVerbose {
-				log.Printf("[DEBUG] Cache is not expired. Reading content...")
-			}
-			content, err := os.ReadFile(cacheFile)
-			if err == nil {
-				host := strings.TrimSpace(string(content))
-				if host != "" {
-					if isVerbose {
-						log.Printf("[DEBUG] Cache hit. Using hostname from cache: \"%s\"", host)
-					}
-					return host, nil
-				}
-				// Cache is empty
-				if isVerbose {
-					log.Printf("[DEBUG] Cache is empty. Will execute command.")
-				}
-			}
-		}
-		// Cache is expired
-		if isVerbose {
-			log.Printf("[DEBUG] Cache is expired. Will execute command.")
-		}
-	} else { // Cache file does not exist
-		if isVerbose {
-			log.Printf("[DEBUG] Cache file does not exist. Will execute command.")
-		}
+	// Serialize refreshes so that concurrent calls run the command once and
+	// never see a partially written cache.
+	l, err := lock.Acquire(ctx, cacheFile+".lock", func(h lock.Holder) {
+		slog.Debug("waiting for the hostname cache lock", "holder", h.String())
+	})
+	if err != nil {
+		return "", fmt.Errorf("Could not lock hostname cachefile: %w", err)
+	}
+	defer l.Unlock()
+	if host, ok := readCache(cacheFile, cacheExpireMinutes); ok {
+		// refreshed by another process while waiting for the lock
+		span.SetAttr("cache", "hit")
+		return host, nil
 	}
 
 	// If cache is non-existent, expired, or empty, fetch the hostname by running the command
-	if isVerbose {
-		log.Printf("[DEBUG] Attempting to get hostname from command: \"%s\"", cmd)
-	}
+	slog.Debug("running the hostname command", "command", cmd)
 	shcmd := strings.Split(cmd, "\n")[0]
 	parts := strings.Fields(shcmd)
 	if len(parts) == 0 {
@@ -67,49 +50,106 @@ func Get(
 	}
 	cmdName := parts[0]
 	cmdArgs := parts[1:]
-	out, err := exec.Command(cmdName, cmdArgs...).Output()
+	_, cmdSpan := trace.Start(ctx, "hostname command")
+	out, err := exec.CommandContext(ctx, cmdName, cmdArgs...).Output()
+	cmdSpan.End()
 	if err != nil {
 		// If command fails, remove the potentially empty/stale cache file to force refetch next time.
-		if isVerbose {
-			log.Printf("[ERROR] Command execution failed. Error: %v", err)
-			if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
-				log.Printf("[ERROR] Command Stderr: %s", strings.TrimSpace(string(exitErr.Stderr)))
-			}
-			log.Printf("[DEBUG] Removing stale cache file: %s", cacheFile)
+		var stderr string
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = strings.TrimSpace(string(exitErr.Stderr))
 		}
+		slog.Error("hostname command failed", "command", cmd, "err", err, "stderr", stderr)
 		os.Remove(cacheFile)
 		return "", errors.New("Could not get hostname from command")
 	}
-	if isVerbose {
-		log.Printf("[DEBUG] Command executed successfully.")
-		log.Printf("[DEBUG] Raw command output: \"%s\"", strings.TrimSpace(string(out)))
-	}
 
 	hostname := strings.TrimSpace(string(out))
+	slog.Debug("hostname command succeeded", "hostname", hostname)
 	if hostname == "" {
-		if isVerbose {
-			log.Printf("[ERROR] Command returned empty output.")
-			log.Printf("[DEBUG] Removing stale cache file: %s", cacheFile)
-		}
 		os.Remove(cacheFile)
 		return "", errors.New("Hostname command returned an empty string")
 	}
-
-	if isVerbose {
-		log.Printf("[DEBUG] Trimmed hostname: \"%s\"", hostname)
-		log.Printf("[DEBUG] Writing new hostname to cache file: %s", cacheFile)
+	if !Valid(hostname) {
+		os.Remove(cacheFile)
+		return "", fmt.Errorf("Hostname command returned an invalid hostname: %q", hostname)
 	}
-	// Write the newly fetched hostname to the cache file
-	err = os.WriteFile(cacheFile, []byte(hostname), 0644)
+
+	// Write the newly fetched hostname to the cache file through a temporary
+	// file, so that a crash never leaves a truncated hostname behind.
+	err = atomicfile.WriteFile(cacheFile, []byte(hostname), 0644)
 	if err != nil {
-		if isVerbose {
-			log.Printf("[ERROR] Failed to write to cache file. Error: %v", err)
-		}
 		return "", fmt.Errorf("Could not write to hostname cachefile: %w", err)
 	}
+	slog.Debug("hostname cached", "file", cacheFile)
+	return hostname, nil
+}
+
+// readCache returns the hostname cached in cacheFile unless it is missing,
+// empty, expired or corrupted. A corrupted cache file is removed.
+func readCache(cacheFile string, cacheExpireMinutes int) (string, bool) {
+	timeBeforeCacheExpires := time.Duration(cacheExpireMinutes) * time.Minute
+
+	cacheFileState, err := os.Stat(cacheFile)
+	if err != nil {
+		slog.Debug("hostname cache missing", "file", cacheFile)
+		return "", false
+	}
+	if cacheFileState.ModTime().Add(timeBeforeCacheExpires).Before(time.Now()) {
+		slog.Debug("hostname cache expired", "file", cacheFile)
+		return "", false
+	}
+	content, err := os.ReadFile(cacheFile)
+	if err != nil {
+		slog.Debug("hostname cache unreadable", "file", cacheFile, "err", err)
+		return "", false
+	}
+	host := strings.TrimSpace(string(content))
+	switch {
+	case host == "":
+		slog.Debug("hostname cache empty", "file", cacheFile)
+		return "", false
+	case !Valid(host):
+		slog.Warn("discarding corrupted hostname cache", "file", cacheFile, "content", host)
+		os.Remove(cacheFile)
+		return "", false
+	}
+	slog.Debug("hostname cache hit", "file", cacheFile, "hostname", host)
+	return host, true
+}
 
-	if isVerbose {
-		log.Printf("[DEBUG] Successfully wrote to cache.")
+// Valid reports whether host is usable as an ssh destination: an IP address
+// or a hostname, optionally preceded by a user name and "@".
+func Valid(host string) bool {
+	if user, h, ok := strings.Cut(host, "@"); ok {
+		if user == "" || strings.IndexFunc(user, func(r rune) bool {
+			return !isHostnameRune(r) && r != '.'
+		}) >= 0 {
+			return false
+		}
+		host = h
 	}
-	return hostname, nil
+	if ip := strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"); net.ParseIP(ip) != nil {
+		return true
+	}
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		if strings.IndexFunc(label, func(r rune) bool { return !isHostnameRune(r) }) >= 0 {
+			return false
+		}
+	}
+	// an all-numeric top-level label is a truncated or malformed IP address
+	return strings.IndexFunc(labels[len(labels)-1], func(r rune) bool { return r < '0' || r > '9' }) >= 0
+}
+
+// isHostnameRune reports whether r may appear in a hostname label. The
+// underscore is accepted since ssh config aliases often use it.
+func isHostnameRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_'
 }
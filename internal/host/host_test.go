@@ -1,10 +1,18 @@
 package host
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/yhiraki/remote/internal/trace"
 )
 
 func TestGet(t *testing.T) {
@@ -20,8 +28,8 @@ func TestGet(t *testing.T) {
 		// Use a simple echo command that is cross-platform enough (usually available in basic shells)
 		// or just "echo" if we assume unix-like environment as per original code structure (ssh/rsync usage)
 		cmd := "echo example.com"
-		
-		host, err := Get(cmd, cacheFile, 60, false)
+
+		host, err := Get(context.Background(), cmd, cacheFile, 60)
 		if err != nil {
 			t.Errorf("Get() error = %v", err)
 		}
@@ -55,7 +63,7 @@ func TestGet(t *testing.T) {
 		// Command that would return something else if executed
 		cmd := "echo new.example.com"
 
-		host, err := Get(cmd, cacheFile, 60, false)
+		host, err := Get(context.Background(), cmd, cacheFile, 60)
 		if err != nil {
 			t.Errorf("Get() error = %v", err)
 		}
@@ -78,7 +86,7 @@ func TestGet(t *testing.T) {
 		}
 
 		cmd := "echo new.example.com"
-		host, err := Get(cmd, cacheFile, 60, false)
+		host, err := Get(context.Background(), cmd, cacheFile, 60)
 		if err != nil {
 			t.Errorf("Get() error = %v", err)
 		}
@@ -88,3 +96,185 @@ func TestGet(t *testing.T) {
 	})
 }
 
+func TestGet_concurrent(t *testing.T) {
+	dir := t.TempDir()
+	cacheFile := filepath.Join(dir, "hostname")
+	script := filepath.Join(dir, "hostname.sh")
+	content := "#!/bin/sh\necho run >> " + filepath.Join(dir, "runs") + "\nsleep 0.2\necho example.com\n"
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			host, err := Get(context.Background(), script, cacheFile, 60)
+			if err != nil || host != "example.com" {
+				t.Errorf("Get() = %q, %v, want example.com", host, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	runs, err := os.ReadFile(filepath.Join(dir, "runs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "run\n"); n != 1 {
+		t.Errorf("hostname command ran %d times, want once", n)
+	}
+}
+
+func TestGet_corruptedCache(t *testing.T) {
+	// contents left behind by interrupted writes
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"truncated ip", "192.168.1"},
+		{"truncated ip with dot", "10.0.0."},
+		{"null bytes", "example.c\x00\x00\x00"},
+		{"garbage", "\xff\xfe\xfd"},
+		{"two hostnames", "example.com other.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheFile := filepath.Join(t.TempDir(), "hostname")
+			if err := os.WriteFile(cacheFile, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			host, err := Get(context.Background(), "echo example.com", cacheFile, 60)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if host != "example.com" {
+				t.Errorf("Get() host = %q, want example.com", host)
+			}
+			content, err := os.ReadFile(cacheFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "example.com" {
+				t.Errorf("cache content = %q, want example.com", content)
+			}
+		})
+	}
+}
+
+func TestGet_invalidOutput(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "hostname")
+	if _, err := Get(context.Background(), "echo not/a/host", cacheFile, 60); err == nil {
+		t.Error("Get() expected error for an invalid hostname, got nil")
+	}
+	if _, err := os.Stat(cacheFile); !os.IsNotExist(err) {
+		t.Errorf("cache file exists after an invalid hostname: %v", err)
+	}
+}
+
+func TestGet_concurrentReaders(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "hostname")
+	hosts := []string{"a.example.com", "10.0.0.1", "very-long-hostname.subdomain.example.com"}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				host, ok := readCache(cacheFile, 60)
+				if !ok {
+					continue
+				}
+				if host != hosts[0] && host != hosts[1] && host != hosts[2] {
+					t.Errorf("readCache() = %q, want one of %q", host, hosts)
+					return
+				}
+			}
+		}()
+	}
+
+	// a cache expiring at once is rewritten by every call
+	for i := 0; i < 30; i++ {
+		if _, err := Get(context.Background(), "echo "+hosts[i%len(hosts)], cacheFile, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestGet_trace(t *testing.T) {
+	cacheFile := filepath.Join(t.TempDir(), "hostname")
+	tr := trace.New()
+	ctx := trace.NewContext(context.Background(), tr)
+	for i := 0; i < 2; i++ {
+		if _, err := Get(ctx, "echo example.com", cacheFile, 60); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := tr.WriteChrome(&b); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		TraceEvents []struct {
+			Name string            `json:"name"`
+			Args map[string]string `json:"args"`
+		} `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	var spans []string
+	for _, e := range got.TraceEvents[1:] {
+		spans = append(spans, e.Name+" "+e.Args["cache"])
+	}
+	want := []string{"host resolution miss", "hostname command ", "host resolution hit"}
+	if !reflect.DeepEqual(spans, want) {
+		t.Errorf("spans = %q, want %q", spans, want)
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"example.com.", true},
+		{"my_server", true},
+		{"localhost", true},
+		{"user@example.com", true},
+		{"first.last@10.0.0.1", true},
+		{"192.168.1.10", true},
+		{"::1", true},
+		{"[fe80::1]", true},
+		{"", false},
+		{"192.168.1", false},
+		{"10.0.0.", false},
+		{"-example.com", false},
+		{"example-.com", false},
+		{"example..com", false},
+		{"exa mple.com", false},
+		{"example.com\x00", false},
+		{"@example.com", false},
+		{"user@", false},
+		{"a@b@c", false},
+		{strings.Repeat("a", 64) + ".com", false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.host); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package hostkey builds the ssh options verifying the host key of the
+// remote host against a known_hosts file managed by remote.
+package hostkey
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yhiraki/remote/internal/atomicfile"
+	"github.com/yhiraki/remote/internal/trace"
+)
+
+// Policy is how the host key of the remote host is verified.
+type Policy string
+
+const (
+	// Default leaves host key verification to the ssh configuration.
+	Default Policy = ""
+	// Strict accepts only the keys already in the known_hosts file.
+	Strict Policy = "strict"
+	// AcceptNew adds the keys of new hosts and refuses changed ones.
+	AcceptNew Policy = "accept-new"
+	// TOFU trusts the first key seen for the profile, whatever its address,
+	// so that the host may change its IP address but not its key.
+	TOFU Policy = "tofu"
+	// Pinned accepts only the keys printed by a command.
+	Pinned Policy = "pinned"
+)
+
+// Parse returns the policy named s.
+func Parse(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case Default, Strict, AcceptNew, TOFU, Pinned:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid host key policy %q (want strict, tofu, accept-new or pinned)", s)
+}
+
+// Options returns the ssh options verifying host keys with policy against
+// knownHosts. alias names the host in knownHosts for the policies which do
+// not depend on its address.
+func Options(policy Policy, knownHosts, alias string) []string {
+	if policy == Default {
+		return nil
+	}
+	if strings.ContainsAny(knownHosts, " \t") {
+		knownHosts = `"` + knownHosts + `"`
+	}
+	opts := []string{"-o", "UserKnownHostsFile=" + knownHosts}
+	switch policy {
+	case Strict:
+		opts = append(opts, "-o", "StrictHostKeyChecking=yes")
+	case AcceptNew:
+		opts = append(opts, "-o", "StrictHostKeyChecking=accept-new")
+	case TOFU:
+		opts = append(opts, "-o", "StrictHostKeyChecking=accept-new", "-o", "HostKeyAlias="+alias, "-o", "CheckHostIP=no")
+	case Pinned:
+		opts = append(opts, "-o", "StrictHostKeyChecking=yes", "-o", "HostKeyAlias="+alias, "-o", "CheckHostIP=no")
+	}
+	return opts
+}
+
+// Pin writes the keys printed by cmd to knownHosts under alias, unless it
+// was written after notBefore.
+//
+// cmd prints one public key ("ssh-ed25519 AAAA..." or a known_hosts line)
+// or one fingerprint ("SHA256:...") per line. Fingerprints select the keys
+// of host scanned with ssh-keyscan.
+func Pin(ctx context.Context, cmd, host, knownHosts, alias string, notBefore time.Time) error {
+	if st, err := os.Stat(knownHosts); err == nil && st.ModTime().After(notBefore) {
+		return nil
+	}
+	parts := strings.Fields(strings.Split(cmd, "\n")[0])
+	if len(parts) == 0 {
+		return fmt.Errorf("hostKeyCommand is required by the pinned host key policy")
+	}
+	ctx, span := trace.Start(ctx, "host key refresh")
+	defer span.End()
+	out, err := exec.CommandContext(ctx, parts[0], parts[1:]...).Output()
+	if err != nil {
+		return fmt.Errorf("could not get the pinned host keys: %w", err)
+	}
+	keys, fingerprints := parsePins(string(out))
+	if len(fingerprints) > 0 {
+		scanned, err := scan(ctx, host)
+		if err != nil {
+			return err
+		}
+		for _, k := range scanned {
+			if fingerprints[Fingerprint(k)] {
+				keys = append(keys, k)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no host key of %s matches the pinned keys", host)
+	}
+
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s %s\n", alias, k)
+	}
+	if err := os.MkdirAll(filepath.Dir(knownHosts), 0o705); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(knownHosts, []byte(b.String()), 0o644)
+}
+
+// Fingerprint returns the SHA-256 fingerprint of key, "type base64", in the
+// format printed by ssh-keygen -l.
+func Fingerprint(key string) string {
+	fields := strings.Fields(key)
+	if len(fields) < 2 {
+		return ""
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// parsePins returns the keys, as "type base64", and the fingerprints in out.
+func parsePins(out string) ([]string, map[string]bool) {
+	var keys []string
+	fingerprints := map[string]bool{}
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "SHA256:") {
+			fingerprints[line] = true
+			continue
+		}
+		if k := parseKey(line); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys, fingerprints
+}
+
+// parseKey returns the key, as "type base64", of a public key or known_hosts
+// line, or "" if there is none.
+func parseKey(line string) string {
+	fields := strings.Fields(line)
+	for i := 0; i+1 < len(fields); i++ {
+		if isKeyType(fields[i]) && isBase64(fields[i+1]) {
+			return fields[i] + " " + fields[i+1]
+		}
+	}
+	return ""
+}
+
+func isKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") || strings.HasPrefix(s, "ecdsa-") || strings.HasPrefix(s, "sk-")
+}
+
+func isBase64(s string) bool {
+	_, err := base64.StdEncoding.DecodeString(s)
+	return err == nil
+}
+
+// scan returns the keys of host, as "type base64", fetched with ssh-keyscan
+// from the address and port ssh connects to.
+func scan(ctx context.Context, host string) ([]string, error) {
+	hostname, port := resolve(ctx, host)
+	out, err := exec.CommandContext(ctx, "ssh-keyscan", "-T", "5", "-p", port, hostname).Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not scan the host keys of %s: %w", host, err)
+	}
+	keys, _ := parsePins(string(out))
+	return keys, nil
+}
+
+// resolve returns the hostname and port of host in the ssh configuration,
+// as printed by ssh -G, since ssh-keyscan ignores it. Without ssh they are
+// those of host itself.
+func resolve(ctx context.Context, host string) (hostname, port string) {
+	if _, h, ok := strings.Cut(host, "@"); ok {
+		host = h
+	}
+	hostname = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	port = "22"
+	out, err := exec.CommandContext(ctx, "ssh", "-G", host).Output()
+	if err != nil {
+		return hostname, port
+	}
+	sc := bufio.NewScanner(strings.NewReader(string(out)))
+	for sc.Scan() {
+		key, value, _ := strings.Cut(sc.Text(), " ")
+		switch key {
+		case "hostname":
+			hostname = value
+		case "port":
+			port = value
+		}
+	}
+	return hostname, port
+}
@@ -0,0 +1,162 @@
+package hostkey
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testKey and its fingerprint as printed by ssh-keygen -l.
+const (
+	testKey         = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIF3iVU+i97wOzX9YBQnH4RhIZK/gMoldGUx+TFyleK6o"
+	testFingerprint = "SHA256:bqXCBOuidJWQ4X+36xzYlxlp4aAze2Eq8PWGzlnnmYM"
+	otherKey        = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQ=="
+)
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{"", "strict", "tofu", "accept-new", "pinned"} {
+		if p, err := Parse(s); err != nil || string(p) != s {
+			t.Errorf("Parse(%q) = %q, %v", s, p, err)
+		}
+	}
+	if _, err := Parse("yes"); err == nil {
+		t.Error(`Parse("yes") expected error, got nil`)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		policy     Policy
+		knownHosts string
+		want       []string
+	}{
+		{Default, "/c/known_hosts", nil},
+		{Strict, "/c/known_hosts", []string{"-o", "UserKnownHostsFile=/c/known_hosts", "-o", "StrictHostKeyChecking=yes"}},
+		{AcceptNew, "/c/known_hosts", []string{"-o", "UserKnownHostsFile=/c/known_hosts", "-o", "StrictHostKeyChecking=accept-new"}},
+		{TOFU, "/c/known_hosts", []string{"-o", "UserKnownHostsFile=/c/known_hosts", "-o", "StrictHostKeyChecking=accept-new", "-o", "HostKeyAlias=remote-gpu", "-o", "CheckHostIP=no"}},
+		{Pinned, "/c/known_hosts", []string{"-o", "UserKnownHostsFile=/c/known_hosts", "-o", "StrictHostKeyChecking=yes", "-o", "HostKeyAlias=remote-gpu", "-o", "CheckHostIP=no"}},
+		{Strict, "/my config/known_hosts", []string{"-o", `UserKnownHostsFile="/my config/known_hosts"`, "-o", "StrictHostKeyChecking=yes"}},
+	}
+	for _, tt := range tests {
+		if got := Options(tt.policy, tt.knownHosts, "remote-gpu"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Options(%q) = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	if got := Fingerprint(testKey + " user@host"); got != testFingerprint {
+		t.Errorf("Fingerprint() = %q, want %q", got, testFingerprint)
+	}
+	if got := Fingerprint("ssh-ed25519 !!!"); got != "" {
+		t.Errorf("Fingerprint() = %q for an invalid key, want empty", got)
+	}
+}
+
+func TestParsePins(t *testing.T) {
+	out := "# keys of gpu\n" +
+		testKey + " root@gpu\n" +
+		"10.0.0.1 " + otherKey + "\n" +
+		"ssh-box " + testKey + "\n" +
+		testFingerprint + "\n" +
+		"garbage\n"
+	keys, fingerprints := parsePins(out)
+	wantKeys := []string{testKey, otherKey, testKey}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("parsePins() keys = %q, want %q", keys, wantKeys)
+	}
+	if !reflect.DeepEqual(fingerprints, map[string]bool{testFingerprint: true}) {
+		t.Errorf("parsePins() fingerprints = %v", fingerprints)
+	}
+}
+
+// writeScript writes an executable shell script printing out.
+func writeScript(t *testing.T, dir, name, out string) string {
+	t.Helper()
+	script := filepath.Join(dir, name)
+	content := "#!/bin/sh\necho run >> " + filepath.Join(dir, name+".runs") + "\ncat <<'EOF'\n" + out + "EOF\n"
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestPin(t *testing.T) {
+	t.Run("keys", func(t *testing.T) {
+		dir := t.TempDir()
+		cmd := writeScript(t, dir, "keys", testKey+" root@gpu\n")
+		knownHosts := filepath.Join(dir, "config", "known_hosts-gpu")
+		if err := Pin(context.Background(), cmd, "10.0.0.1", knownHosts, "remote-gpu", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(knownHosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "remote-gpu " + testKey + "\n"; string(got) != want {
+			t.Errorf("known_hosts = %q, want %q", got, want)
+		}
+
+		// a file written after notBefore is kept
+		if err := Pin(context.Background(), cmd, "10.0.0.1", knownHosts, "remote-gpu", time.Now().Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+		runs, _ := os.ReadFile(filepath.Join(dir, "keys.runs"))
+		if string(runs) != "run\n" {
+			t.Errorf("key command runs = %q, want one", runs)
+		}
+	})
+
+	t.Run("fingerprints", func(t *testing.T) {
+		dir := t.TempDir()
+		cmd := writeScript(t, dir, "fingerprints", testFingerprint+"\n")
+		writeScript(t, dir, "ssh-keyscan", "# 10.0.0.1:22 SSH-2.0-OpenSSH\n10.0.0.1 "+otherKey+"\n10.0.0.1 "+testKey+"\n")
+		t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		knownHosts := filepath.Join(dir, "known_hosts")
+		if err := Pin(context.Background(), cmd, "user@10.0.0.1", knownHosts, "remote", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(knownHosts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "remote " + testKey + "\n"; string(got) != want {
+			t.Errorf("known_hosts = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("ssh config", func(t *testing.T) {
+		dir := t.TempDir()
+		cmd := writeScript(t, dir, "fingerprints", testFingerprint+"\n")
+		writeScript(t, dir, "ssh", "hostname gpu.internal\nport 2222\n")
+		keyscan := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "ssh-keyscan.args") + "\necho 'gpu.internal " + testKey + "'\n"
+		if err := os.WriteFile(filepath.Join(dir, "ssh-keyscan"), []byte(keyscan), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		if err := Pin(context.Background(), cmd, "gpu", filepath.Join(dir, "known_hosts"), "remote", time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		args, _ := os.ReadFile(filepath.Join(dir, "ssh-keyscan.args"))
+		if want := "-T 5 -p 2222 gpu.internal\n"; string(args) != want {
+			t.Errorf("ssh-keyscan args = %q, want %q", args, want)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		dir := t.TempDir()
+		cmd := writeScript(t, dir, "fingerprints", "SHA256:unknown\n")
+		writeScript(t, dir, "ssh-keyscan", "10.0.0.1 "+testKey+"\n")
+		t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		knownHosts := filepath.Join(dir, "known_hosts")
+		if err := Pin(context.Background(), cmd, "10.0.0.1", knownHosts, "remote", time.Time{}); err == nil {
+			t.Error("Pin() expected error, got nil")
+		}
+		if _, err := os.Stat(knownHosts); !os.IsNotExist(err) {
+			t.Errorf("known_hosts written without a matching key: %v", err)
+		}
+	})
+}
@@ -0,0 +1,96 @@
+// Package lock provides advisory file locks held by one process at a time.
+package lock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrLocked is returned by TryLock when another process holds the lock.
+var ErrLocked = errors.New("locked by another process")
+
+// pollInterval is how often Acquire retries a held lock.
+const pollInterval = 100 * time.Millisecond
+
+// Lock is a lock held on a file.
+type Lock struct {
+	f    *os.File
+	path string
+}
+
+// Holder describes the process holding a lock.
+type Holder struct {
+	PID     int
+	Command string
+}
+
+func (h Holder) String() string {
+	if h.PID == 0 {
+		return "unknown process"
+	}
+	return fmt.Sprintf("pid %d: %s", h.PID, h.Command)
+}
+
+// TryLock acquires the lock on the file at path, creating it, or returns
+// ErrLocked at once if it is held.
+func TryLock(path string) (*Lock, error) {
+	f, err := tryLock(path)
+	if err != nil {
+		return nil, err
+	}
+	// record the holder for the processes waiting for the lock
+	holder := fmt.Sprintf("%d\n%s\n", os.Getpid(), strings.Join(os.Args, " "))
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(holder), 0)
+	}
+	return &Lock{f: f, path: path}, nil
+}
+
+// Acquire waits until it acquires the lock on the file at path or ctx is
+// done. If the lock is held, onWait, when not nil, is called once with its
+// holder before waiting.
+func Acquire(ctx context.Context, path string, onWait func(Holder)) (*Lock, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	waiting := false
+	for {
+		l, err := TryLock(path)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+		if !waiting && onWait != nil {
+			h, _ := ReadHolder(path)
+			onWait(h)
+		}
+		waiting = true
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReadHolder returns the process which acquired the lock on path last.
+func ReadHolder(path string) (Holder, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Holder{}, err
+	}
+	pid, command, _ := strings.Cut(strings.TrimSuffix(string(content), "\n"), "\n")
+	n, err := strconv.Atoi(pid)
+	if err != nil {
+		return Holder{}, fmt.Errorf("invalid lock file %s", path)
+	}
+	return Holder{PID: n, Command: command}, nil
+}
+
+// Unlock releases the lock.
+func (l *Lock) Unlock() error {
+	return unlock(l.f, l.path)
+}
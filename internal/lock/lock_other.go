@@ -0,0 +1,24 @@
+//go:build !unix
+
+package lock
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// Without flock, the lock is the existence of the file, which is left
+// behind if the process holding it is killed.
+func tryLock(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, ErrLocked
+	}
+	return f, err
+}
+
+func unlock(f *os.File, path string) error {
+	f.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,73 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	l, err := TryLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TryLock(path); !errors.Is(err, ErrLocked) {
+		t.Errorf("TryLock() of a held lock error = %v, want ErrLocked", err)
+	}
+	h, err := ReadHolder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.PID != os.Getpid() {
+		t.Errorf("ReadHolder().PID = %d, want %d", h.PID, os.Getpid())
+	}
+
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = TryLock(path)
+	if err != nil {
+		t.Fatalf("TryLock() after Unlock() error = %v", err)
+	}
+	l.Unlock()
+}
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	held, err := TryLock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := Acquire(ctx, path, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() of a held lock error = %v, want deadline exceeded", err)
+	}
+
+	waited := make(chan Holder, 1)
+	acquired := make(chan error, 1)
+	go func() {
+		l, err := Acquire(context.Background(), path, func(h Holder) { waited <- h })
+		if err == nil {
+			l.Unlock()
+		}
+		acquired <- err
+	}()
+	if h := <-waited; h.PID != os.Getpid() {
+		t.Errorf("waiting on holder %v, want pid %d", h, os.Getpid())
+	}
+	held.Unlock()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Acquire() did not return after the lock was released")
+	}
+}
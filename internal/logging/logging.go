@@ -0,0 +1,166 @@
+// Package logging configures the leveled structured logger used by remote,
+// the default logger of log/slog.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// EnvVar is the environment variable holding the default logging options.
+const EnvVar = "REMOTE_LOG"
+
+// Options selects what is logged, in which format and where.
+type Options struct {
+	Level slog.Level
+	// Format is text or json.
+	Format string
+	// File receives the logs, appended to, instead of stderr when set.
+	File string
+}
+
+// DefaultOptions logs warnings and errors as text on stderr.
+var DefaultOptions = Options{Level: slog.LevelWarn, Format: "text"}
+
+// ParseLevel returns the level named s: debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q (want debug, info, warn or error)", s)
+	}
+	return l, nil
+}
+
+// ParseFormat checks that s is a log format.
+func ParseFormat(s string) (string, error) {
+	if s != "text" && s != "json" {
+		return "", fmt.Errorf("invalid log format %q (want text or json)", s)
+	}
+	return s, nil
+}
+
+// ParseEnv updates o with the value of EnvVar: a level, or comma separated
+// level=, format= and file= settings such as "level=debug,format=json".
+func ParseEnv(s string, o *Options) error {
+	if s == "" {
+		return nil
+	}
+	var err error
+	for _, setting := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			key, value = "level", setting
+		}
+		switch strings.TrimSpace(key) {
+		case "level":
+			o.Level, err = ParseLevel(value)
+		case "format":
+			o.Format, err = ParseFormat(value)
+		case "file":
+			o.File = value
+		default:
+			err = fmt.Errorf("unknown setting %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", EnvVar, err)
+		}
+	}
+	return nil
+}
+
+// Setup makes the default logger write to stderr, or to o.File, as o says.
+// The returned function closes the file.
+func Setup(o Options, stderr io.Writer) (close func() error, err error) {
+	w, close := stderr, func() error { return nil }
+	if o.File != "" {
+		f, err := os.OpenFile(o.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		w, close = f, f.Close
+	}
+	slog.SetDefault(slog.New(NewHandler(w, o)))
+	return close, nil
+}
+
+// NewHandler returns a handler writing records of o.Level and above to w.
+func NewHandler(w io.Writer, o Options) slog.Handler {
+	opts := &slog.HandlerOptions{Level: o.Level}
+	if o.Format == "json" {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// Buffer is a handler keeping every record, logged before the options are
+// known, until Flush passes them on.
+type Buffer struct {
+	mu      sync.Mutex
+	records []buffered
+}
+
+type buffered struct {
+	with []func(slog.Handler) slog.Handler // WithAttrs and WithGroup calls
+	r    slog.Record
+}
+
+// Handler returns the handler keeping the records in b.
+func (b *Buffer) Handler() slog.Handler {
+	return bufferHandler{b: b}
+}
+
+// Flush passes the records kept so far to h, which drops those below its
+// level, and forgets them.
+func (b *Buffer) Flush(h slog.Handler) error {
+	b.mu.Lock()
+	records := b.records
+	b.records = nil
+	b.mu.Unlock()
+	for _, rec := range records {
+		h := h
+		for _, with := range rec.with {
+			h = with(h)
+		}
+		if !h.Enabled(context.Background(), rec.r.Level) {
+			continue
+		}
+		if err := h.Handle(context.Background(), rec.r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type bufferHandler struct {
+	b    *Buffer
+	with []func(slog.Handler) slog.Handler
+}
+
+func (h bufferHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h bufferHandler) Handle(_ context.Context, r slog.Record) error {
+	h.b.mu.Lock()
+	defer h.b.mu.Unlock()
+	h.b.records = append(h.b.records, buffered{with: h.with, r: r.Clone()})
+	return nil
+}
+
+func (h bufferHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.chain(func(h slog.Handler) slog.Handler { return h.WithAttrs(attrs) })
+}
+
+func (h bufferHandler) WithGroup(name string) slog.Handler {
+	return h.chain(func(h slog.Handler) slog.Handler { return h.WithGroup(name) })
+}
+
+func (h bufferHandler) chain(with func(slog.Handler) slog.Handler) slog.Handler {
+	h.with = append(h.with[:len(h.with):len(h.with)], with)
+	return h
+}
@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	tests := []struct {
+		env     string
+		want    Options
+		wantErr bool
+	}{
+		{env: "", want: DefaultOptions},
+		{env: "debug", want: Options{Level: slog.LevelDebug, Format: "text"}},
+		{env: "INFO", want: Options{Level: slog.LevelInfo, Format: "text"}},
+		{env: "level=error,format=json,file=/tmp/remote.log", want: Options{Level: slog.LevelError, Format: "json", File: "/tmp/remote.log"}},
+		{env: "verbose", wantErr: true},
+		{env: "format=xml", wantErr: true},
+		{env: "color=on", wantErr: true},
+	}
+	for _, tt := range tests {
+		o := DefaultOptions
+		err := ParseEnv(tt.env, &o)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseEnv(%q) error = %v, wantErr %v", tt.env, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && o != tt.want {
+			t.Errorf("ParseEnv(%q) = %+v, want %+v", tt.env, o, tt.want)
+		}
+	}
+}
+
+func TestSetup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	var stderr bytes.Buffer
+	closeLog, err := Setup(Options{Level: slog.LevelInfo, Format: "json"}, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slog.Debug("hidden")
+	slog.Info("shown", "host", "example.com")
+	closeLog()
+	var rec map[string]interface{}
+	if err := json.Unmarshal(stderr.Bytes(), &rec); err != nil {
+		t.Fatalf("log = %q: %v", stderr.String(), err)
+	}
+	if rec["level"] != "INFO" || rec["msg"] != "shown" || rec["host"] != "example.com" {
+		t.Errorf("log record = %v", rec)
+	}
+
+	file := filepath.Join(t.TempDir(), "remote.log")
+	closeLog, err = Setup(Options{Level: slog.LevelWarn, Format: "text", File: file}, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slog.Warn("to file")
+	if err := closeLog(); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "level=WARN msg=\"to file\"") {
+		t.Errorf("log file = %q", content)
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  string
+	}{
+		{slog.LevelDebug, "level=DEBUG msg=\"project config found\" file=.remoterc.json\nlevel=WARN msg=stale host=gpu cache.age=2h\n"},
+		{slog.LevelWarn, "level=WARN msg=stale host=gpu cache.age=2h\n"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		h := slog.NewTextHandler(&out, &slog.HandlerOptions{
+			Level: tt.level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey && len(groups) == 0 {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})
+		b := &Buffer{}
+		logger := slog.New(b.Handler())
+		logger.Debug("project config found", "file", ".remoterc.json")
+		logger.With("host", "gpu").WithGroup("cache").Warn("stale", "age", "2h")
+		if err := b.Flush(h); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("Flush() at %v wrote %q, want %q", tt.level, out.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package rsync parses the output of rsync run with --itemize-changes,
+// --info=progress2 and --stats.
+package rsync
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Progress is the overall transfer progress reported by --info=progress2.
+type Progress struct {
+	Bytes   int64
+	Percent int
+	Rate    string // as printed by rsync, e.g. "1.23MB/s"
+	ETA     string // as printed by rsync, e.g. "0:00:12"
+}
+
+// ChangeKind classifies an itemized change.
+type ChangeKind int
+
+const (
+	Unchanged ChangeKind = iota // only attributes such as times changed
+	Added
+	Updated
+	Deleted
+)
+
+// Change is one line of --itemize-changes output.
+type Change struct {
+	Kind  ChangeKind
+	Path  string
+	IsDir bool
+}
+
+// Stats sums up a transfer.
+type Stats struct {
+	Added         int
+	Updated       int
+	Deleted       int
+	BytesSent     int64
+	BytesReceived int64
+}
+
+// Parser is an io.Writer consuming rsync's stdout. Itemized changes are
+// counted into Stats, which also gets the byte counts of --stats.
+type Parser struct {
+	OnProgress func(Progress)
+	OnChange   func(Change)
+	Stats      Stats
+
+	buf []byte
+}
+
+// Write parses every complete line of p, keeping the rest until the next call.
+// Progress updates end with a carriage return rather than a newline.
+func (p *Parser) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexAny(p.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		p.parseLine(string(p.buf[:i]))
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Close parses the last line if it was not terminated.
+func (p *Parser) Close() error {
+	if len(p.buf) > 0 {
+		p.parseLine(string(p.buf))
+		p.buf = nil
+	}
+	return nil
+}
+
+func (p *Parser) parseLine(line string) {
+	if line == "" {
+		return
+	}
+	if pr, ok := ParseProgress(line); ok {
+		if p.OnProgress != nil {
+			p.OnProgress(pr)
+		}
+		return
+	}
+	if n, ok := parseStat(line, "Total bytes sent:"); ok {
+		p.Stats.BytesSent = n
+		return
+	}
+	if n, ok := parseStat(line, "Total bytes received:"); ok {
+		p.Stats.BytesReceived = n
+		return
+	}
+	ch, ok := ParseChange(line)
+	if !ok {
+		return
+	}
+	if !ch.IsDir {
+		switch ch.Kind {
+		case Added:
+			p.Stats.Added++
+		case Updated:
+			p.Stats.Updated++
+		case Deleted:
+			p.Stats.Deleted++
+		}
+	}
+	if p.OnChange != nil {
+		p.OnChange(ch)
+	}
+}
+
+// ParseProgress parses a line of --info=progress2 output such as
+// "  1,238,099  42%  146.38kB/s  0:00:08 (xfr#5, to-chk=0/6)".
+func ParseProgress(line string) (Progress, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || !strings.HasSuffix(fields[1], "%") || !strings.HasSuffix(fields[2], "/s") {
+		return Progress{}, false
+	}
+	n, err := parseNumber(fields[0])
+	if err != nil {
+		return Progress{}, false
+	}
+	pct, err := strconv.Atoi(strings.TrimSuffix(fields[1], "%"))
+	if err != nil {
+		return Progress{}, false
+	}
+	return Progress{Bytes: n, Percent: pct, Rate: fields[2], ETA: fields[3]}, true
+}
+
+// ParseChange parses a line of --itemize-changes output such as
+// ">f.st...... src/main.go" or "*deleting   old.txt".
+func ParseChange(line string) (Change, bool) {
+	if path, ok := ParseDeletion(line); ok {
+		return Change{Kind: Deleted, Path: path, IsDir: strings.HasSuffix(path, "/")}, true
+	}
+	// YXcstpoguax followed by a space and the name
+	i := strings.IndexByte(line, ' ')
+	if i < 9 || i > 11 || !strings.ContainsRune("<>ch.", rune(line[0])) || !strings.ContainsRune("fdLDS", rune(line[1])) {
+		return Change{}, false
+	}
+	ch := Change{Path: line[i+1:], IsDir: line[1] == 'd'}
+	switch attrs := line[2:i]; {
+	case strings.Trim(attrs, "+") == "":
+		ch.Kind = Added
+	case line[0] == '.':
+		ch.Kind = Unchanged
+	default:
+		ch.Kind = Updated
+	}
+	return ch, true
+}
+
+// ParseDeletion returns the path of an itemized deletion such as
+// "*deleting   old.txt".
+func ParseDeletion(line string) (string, bool) {
+	rest, ok := strings.CutPrefix(line, "*deleting ")
+	if !ok {
+		return "", false
+	}
+	return strings.TrimLeft(rest, " "), true
+}
+
+func parseStat(line, prefix string) (int64, bool) {
+	rest, ok := strings.CutPrefix(line, prefix)
+	if !ok {
+		return 0, false
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	n, err := parseNumber(fields[0])
+	return n, err == nil
+}
+
+// parseNumber parses an integer printed with thousands separators.
+func parseNumber(s string) (int64, error) {
+	return strconv.ParseInt(strings.ReplaceAll(s, ",", ""), 10, 64)
+}
@@ -0,0 +1,96 @@
+package rsync
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestParser parses the output of a push with deletions. testdata/gen.sh
+// regenerates it from the local rsync; the byte counts then need updating.
+func TestParser(t *testing.T) {
+	out, err := os.ReadFile("testdata/push.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []Progress
+	var changes []string
+	p := &Parser{
+		OnProgress: func(pr Progress) { progress = append(progress, pr) },
+		OnChange:   func(ch Change) { changes = append(changes, ch.Path) },
+	}
+	// feed the output in small chunks, as it arrives from the pipe
+	for len(out) > 0 {
+		n := 7
+		if n > len(out) {
+			n = len(out)
+		}
+		p.Write(out[:n])
+		out = out[n:]
+	}
+	p.Close()
+
+	wantStats := Stats{Added: 2, Updated: 1, Deleted: 2, BytesSent: 25043, BytesReceived: 224}
+	if p.Stats != wantStats {
+		t.Errorf("Stats = %+v, want %+v", p.Stats, wantStats)
+	}
+	if len(progress) != 4 {
+		t.Fatalf("got %d progress updates, want 4", len(progress))
+	}
+	wantLast := Progress{Bytes: 28672, Percent: 99, Rate: "9.11MB/s", ETA: "0:00:00"}
+	if progress[3] != wantLast {
+		t.Errorf("last progress = %+v, want %+v", progress[3], wantLast)
+	}
+	wantChanges := []string{"tmp/cache.bin", "tmp/", "old.txt", "./", "Makefile", "README.md", "src/", "src/main.go", "src/util.go"}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("changes = %q, want %q", changes, wantChanges)
+	}
+}
+
+func TestParseProgress(t *testing.T) {
+	tests := []struct {
+		line string
+		want Progress
+		ok   bool
+	}{
+		{line: "  1,238,099  42%  146.38kB/s    0:00:08 (xfr#5, ir-chk=1005/1007)", want: Progress{Bytes: 1238099, Percent: 42, Rate: "146.38kB/s", ETA: "0:00:08"}, ok: true},
+		{line: "          0   0%    0.00kB/s    0:00:00", want: Progress{Rate: "0.00kB/s", ETA: "0:00:00"}, ok: true},
+		{line: ">f+++++++++ 100% done.txt"},
+		{line: "sent 33,310 bytes  received 111 bytes  66,842.00 bytes/sec"},
+		{line: "Total bytes sent: 33,310"},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseProgress(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseProgress(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseChange(t *testing.T) {
+	tests := []struct {
+		line string
+		want Change
+		ok   bool
+	}{
+		{line: ">f+++++++++ a b.txt", want: Change{Kind: Added, Path: "a b.txt"}, ok: true},
+		{line: "<f.st...... src/main.go", want: Change{Kind: Updated, Path: "src/main.go"}, ok: true},
+		{line: "cd+++++++++ src/", want: Change{Kind: Added, Path: "src/", IsDir: true}, ok: true},
+		{line: ".d..t...... ./", want: Change{Kind: Unchanged, Path: "./", IsDir: true}, ok: true},
+		{line: "cL+++++++++ link -> target", want: Change{Kind: Added, Path: "link -> target"}, ok: true},
+		{line: "*deleting   old.txt", want: Change{Kind: Deleted, Path: "old.txt"}, ok: true},
+		{line: "*deleting   tmp/", want: Change{Kind: Deleted, Path: "tmp/", IsDir: true}, ok: true},
+		{line: "deleting old.txt"},
+		{line: "sending incremental file list"},
+		{line: "Number of files: 7 (reg: 5, dir: 2)"},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseChange(tt.line)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseChange(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+#!/bin/sh
+# gen.sh regenerates push.txt: the output of rsync sending a tree to an
+# existing one with deletions, as remote push --mirror runs it. The remote
+# side is run locally through a fake remote shell.
+set -e
+out=$(cd "$(dirname "$0")" && pwd)/push.txt
+tmp=$(mktemp -d)
+trap 'rm -rf "$tmp"' EXIT
+cd "$tmp"
+
+printf '#!/bin/sh\nshift\nexec "$@"\n' > rsh
+chmod +x rsh
+
+mkdir -p src/src dst/src dst/tmp
+head -c 100 /dev/zero > src/Makefile
+cp src/Makefile dst/Makefile
+chmod 600 dst/Makefile
+head -c 8192 /dev/urandom > src/README.md
+head -c 12288 /dev/urandom > src/src/main.go
+head -c 8192 /dev/urandom > src/src/util.go
+head -c 4096 src/src/util.go > dst/src/util.go
+touch -t 202001010000 dst/src/util.go
+head -c 10 /dev/zero > dst/old.txt
+head -c 10 /dev/zero > dst/tmp/cache.bin
+
+rsync -a --delete --itemize-changes --info=progress2 --stats -e ./rsh src/ remote:dst/ > "$out"
@@ -0,0 +1,99 @@
+// Package shell provides quoting helpers for building POSIX shell command lines.
+package shell
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Quote returns s quoted so that a POSIX shell reads it back as exactly one word.
+// Strings made only of characters without special meaning are returned as is.
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if isSafe(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Join quotes each element of args and joins them with spaces.
+func Join(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, Quote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func isSafe(s string) bool {
+	for _, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case strings.ContainsRune("_-./:@%+,", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Split splits s into words like a POSIX shell does, honouring single quotes,
+// double quotes and backslash escapes. No expansion is performed.
+func Split(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		escaped bool
+		quote   byte
+	)
+	for i := 0; i < len(s); i++ {
+		r := s[i]
+		switch {
+		case escaped:
+			if quote == '"' && strings.IndexByte("$`\"\\\n", r) < 0 {
+				word.WriteByte('\\')
+			}
+			if r != '\n' {
+				word.WriteByte(r)
+			}
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteByte(r)
+			}
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteByte(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(r)
+			inWord = true
+		}
+	}
+	if escaped || quote != 0 {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
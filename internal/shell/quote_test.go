@@ -0,0 +1,118 @@
+package shell
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "empty", in: "", want: "''"},
+		{name: "safe word", in: "ls", want: "ls"},
+		{name: "path", in: "src/main.go", want: "src/main.go"},
+		{name: "remote spec", in: "user@example.com:dir/", want: "user@example.com:dir/"},
+		{name: "space", in: "foo bar", want: "'foo bar'"},
+		{name: "single quote", in: "it's", want: `'it'\''s'`},
+		{name: "variable", in: "$HOME", want: "'$HOME'"},
+		{name: "assignment", in: "FOO=BAR", want: "'FOO=BAR'"},
+		{name: "glob", in: "*.go", want: "'*.go'"},
+		{name: "tilde", in: "~/dir", want: "'~/dir'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Quote(tt.in); got != tt.want {
+				t.Errorf("Quote(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoin(t *testing.T) {
+	got := Join([]string{"grep", "foo bar", "file"})
+	want := "grep 'foo bar' file"
+	if got != want {
+		t.Errorf("Join() = %v, want %v", got, want)
+	}
+}
+
+// FuzzJoin checks that every argument survives a round trip through sh -c.
+func FuzzJoin(f *testing.F) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		f.Skip("sh not found")
+	}
+	f.Add("foo bar", "it's")
+	f.Add("$(id)", "'\"\\")
+	f.Add("", "\n\t")
+	f.Add("~", "a=b")
+
+	f.Fuzz(func(t *testing.T, a, b string) {
+		if strings.ContainsRune(a, 0) || strings.ContainsRune(b, 0) {
+			t.Skip()
+		}
+		script := `printf '%s\0' ` + Join([]string{a, b})
+		out, err := exec.Command("sh", "-c", script).Output()
+		if err != nil {
+			t.Fatalf("sh -c %q: %v", script, err)
+		}
+		want := a + "\x00" + b + "\x00"
+		if string(out) != want {
+			t.Errorf("sh -c %q = %q, want %q", script, out, want)
+		}
+	})
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", in: "", want: nil},
+		{name: "words", in: "  docker compose\tup -d ", want: []string{"docker", "compose", "up", "-d"}},
+		{name: "single quotes", in: `grep 'foo bar' "it's"`, want: []string{"grep", "foo bar", "it's"}},
+		{name: "double quote escapes", in: `echo "a \"b\" \$c \d"`, want: []string{"echo", `a "b" $c \d`}},
+		{name: "backslash", in: `a\ b c\'d`, want: []string{"a b", "c'd"}},
+		{name: "empty word", in: `echo ''`, want: []string{"echo", ""}},
+		{name: "adjacent quotes", in: `'a'"b"c`, want: []string{"abc"}},
+		{name: "unterminated quote", in: `echo 'foo`, wantErr: true},
+		{name: "trailing backslash", in: `echo \`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Split(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Split() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// FuzzSplit checks that Split reverses Join.
+func FuzzSplit(f *testing.F) {
+	f.Add("foo bar", "it's")
+	f.Add("", `"\`)
+
+	f.Fuzz(func(t *testing.T, a, b string) {
+		args := []string{a, b}
+		got, err := Split(Join(args))
+		if err != nil {
+			t.Fatalf("Split(%q) error = %v", Join(args), err)
+		}
+		if !reflect.DeepEqual(got, args) {
+			t.Errorf("Split(Join(%q)) = %q", args, got)
+		}
+	})
+}
@@ -0,0 +1,9 @@
+// Package term reports whether files are connected to a terminal.
+package term
+
+import "os"
+
+// IsTerminal reports whether f refers to a terminal device.
+func IsTerminal(f *os.File) bool {
+	return isTerminal(f)
+}
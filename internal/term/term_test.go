@@ -0,0 +1,29 @@
+package term
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.CreateTemp("", "remote_term_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if IsTerminal(f) {
+		t.Errorf("IsTerminal(%s) = true, want false", f.Name())
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if IsTerminal(r) {
+		t.Error("IsTerminal(pipe) = true, want false")
+	}
+}
@@ -0,0 +1,228 @@
+// Package trace records the time spent in the phases of an invocation as
+// nested spans, reported as a timing breakdown or as Chrome trace events.
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer collects the spans of an invocation.
+type Tracer struct {
+	mu    sync.Mutex
+	now   func() time.Time
+	start time.Time
+	spans []*Span
+}
+
+// Span is a timed phase, possibly within another one. The methods of a nil
+// Span do nothing, so that code runs the same without a Tracer.
+type Span struct {
+	t          *Tracer
+	parent     *Span
+	name       string
+	start, end time.Time
+	attrs      []Attr
+}
+
+// Attr is an annotation of a span, such as whether a cache was hit.
+type Attr struct {
+	Key, Value string
+}
+
+type tracerKey struct{}
+
+type spanKey struct{}
+
+// New returns a Tracer starting now.
+func New() *Tracer {
+	return &Tracer{now: time.Now, start: time.Now()}
+}
+
+// NewContext returns a copy of ctx in which spans are recorded by t.
+func NewContext(ctx context.Context, t *Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, t)
+}
+
+// FromContext returns the Tracer of ctx, nil if there is none.
+func FromContext(ctx context.Context) *Tracer {
+	t, _ := ctx.Value(tracerKey{}).(*Tracer)
+	return t
+}
+
+// Start begins a span named name within the span of ctx, if any, and
+// returns a context holding it. Without a Tracer in ctx the span is nil.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	t := FromContext(ctx)
+	if t == nil {
+		return ctx, nil
+	}
+	s := t.add(ctx, name, t.now(), time.Time{})
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Record adds a span that already ended within the span of ctx, such as a
+// phase observed in the output of a process.
+func Record(ctx context.Context, name string, start, end time.Time) *Span {
+	t := FromContext(ctx)
+	if t == nil {
+		return nil
+	}
+	return t.add(ctx, name, start, end)
+}
+
+func (t *Tracer) add(ctx context.Context, name string, start, end time.Time) *Span {
+	parent, _ := ctx.Value(spanKey{}).(*Span)
+	s := &Span{t: t, parent: parent, name: name, start: start, end: end}
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return s
+}
+
+// SetAttr annotates s, replacing the value of key if already set.
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	v := fmt.Sprint(value)
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	for i := range s.attrs {
+		if s.attrs[i].Key == key {
+			s.attrs[i].Value = v
+			return
+		}
+	}
+	s.attrs = append(s.attrs, Attr{Key: key, Value: v})
+}
+
+// End ends s. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	if s.end.IsZero() {
+		s.end = s.t.now()
+	}
+}
+
+// sorted returns the spans in depth-first order, children by start time,
+// with their depth. Spans still running end at now.
+func (t *Tracer) sorted(now time.Time) (spans []Span, depths []int) {
+	children := map[*Span][]*Span{}
+	for _, s := range t.spans {
+		children[s.parent] = append(children[s.parent], s)
+	}
+	var walk func(parent *Span, depth int)
+	walk = func(parent *Span, depth int) {
+		cs := children[parent]
+		sort.SliceStable(cs, func(i, j int) bool { return cs[i].start.Before(cs[j].start) })
+		for _, s := range cs {
+			c := *s
+			if c.end.IsZero() {
+				c.end = now
+			}
+			spans = append(spans, c)
+			depths = append(depths, depth)
+			walk(s, depth+1)
+		}
+	}
+	walk(nil, 0)
+	return spans, depths
+}
+
+// Report writes the duration of every span, indented under its parent, and
+// its share of the time elapsed since t started.
+func (t *Tracer) Report(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	total := now.Sub(t.start)
+	spans, depths := t.sorted(now)
+
+	width := 0
+	for i, s := range spans {
+		if n := 2*depths[i] + len(s.name); n > width {
+			width = n
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Timing breakdown (%s in total):\n", round(total))
+	for i, s := range spans {
+		d := s.end.Sub(s.start)
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(d) / float64(total)
+		}
+		fmt.Fprintf(&b, "  %-*s %10s %5.1f%%", width, strings.Repeat("  ", depths[i])+s.name, round(d), share)
+		for _, a := range s.attrs {
+			fmt.Fprintf(&b, " %s=%s", a.Key, a.Value)
+		}
+		b.WriteByte('\n')
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// round shortens d to four significant digits or so.
+func round(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// event is a complete event of the Chrome trace event format.
+type event struct {
+	Name string            `json:"name"`
+	Ph   string            `json:"ph"`
+	Ts   int64             `json:"ts"`
+	Dur  int64             `json:"dur"`
+	Pid  int               `json:"pid"`
+	Tid  int               `json:"tid"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// WriteChrome writes the spans in the Chrome trace event format, read by
+// chrome://tracing and Perfetto, with times relative to the start of t.
+func (t *Tracer) WriteChrome(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans, _ := t.sorted(t.now())
+	pid := os.Getpid()
+	events := []event{{Name: "process_name", Ph: "M", Pid: pid, Tid: 1, Args: map[string]string{"name": "remote"}}}
+	for _, s := range spans {
+		e := event{
+			Name: s.name,
+			Ph:   "X",
+			Ts:   s.start.Sub(t.start).Microseconds(),
+			Dur:  s.end.Sub(s.start).Microseconds(),
+			Pid:  pid,
+			Tid:  1,
+		}
+		if len(s.attrs) > 0 {
+			e.Args = map[string]string{}
+			for _, a := range s.attrs {
+				e.Args[a.Key] = a.Value
+			}
+		}
+		events = append(events, e)
+	}
+	return json.NewEncoder(w).Encode(struct {
+		TraceEvents     []event `json:"traceEvents"`
+		DisplayTimeUnit string  `json:"displayTimeUnit"`
+	}{events, "ms"})
+}
@@ -0,0 +1,102 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// fakeClock returns a Tracer whose clock only moves with advance.
+func fakeClock() (*Tracer, func(time.Duration)) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	t := &Tracer{start: now}
+	t.now = func() time.Time { return now }
+	return t, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestReport(t *testing.T) {
+	tr, advance := fakeClock()
+	ctx := NewContext(context.Background(), tr)
+
+	_, cfg := Start(ctx, "config discovery")
+	advance(2 * time.Millisecond)
+	cfg.End()
+
+	_, host := Start(ctx, "host resolution")
+	host.SetAttr("cache", "miss")
+	advance(18 * time.Millisecond)
+	host.SetAttr("cache", "hit")
+	host.End()
+	host.End()
+
+	sshCtx, ssh := Start(ctx, "ssh")
+	start := tr.now()
+	advance(30 * time.Millisecond)
+	authenticated := tr.now()
+	advance(50 * time.Millisecond)
+	Record(sshCtx, "remote execution", authenticated, tr.now())
+	Record(sshCtx, "connection", start, authenticated).SetAttr("auth", "publickey")
+	ssh.End()
+
+	var b bytes.Buffer
+	if err := tr.Report(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `Timing breakdown (100ms in total):
+  config discovery          2ms   2.0%
+  host resolution          18ms  18.0% cache=hit
+  ssh                      80ms  80.0%
+    connection             30ms  30.0% auth=publickey
+    remote execution       50ms  50.0%
+`
+	if b.String() != want {
+		t.Errorf("Report() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestWriteChrome(t *testing.T) {
+	tr, advance := fakeClock()
+	ctx := NewContext(context.Background(), tr)
+	advance(time.Millisecond)
+	ctx, outer := Start(ctx, "transfer")
+	outer.SetAttr("command", "rsync")
+	advance(3 * time.Millisecond)
+	_, inner := Start(ctx, "running")
+	advance(time.Millisecond)
+
+	var b bytes.Buffer
+	if err := tr.WriteChrome(&b); err != nil {
+		t.Fatal(err)
+	}
+	inner.End()
+	var got struct {
+		TraceEvents []event `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.TraceEvents) != 3 || got.TraceEvents[0].Ph != "M" {
+		t.Fatalf("events = %+v", got.TraceEvents)
+	}
+	transfer, running := got.TraceEvents[1], got.TraceEvents[2]
+	if transfer.Name != "transfer" || transfer.Ph != "X" || transfer.Ts != 1000 || transfer.Dur != 4000 || transfer.Args["command"] != "rsync" {
+		t.Errorf("transfer event = %+v", transfer)
+	}
+	if running.Name != "running" || running.Ts != 4000 || running.Dur != 1000 {
+		t.Errorf("running event = %+v", running)
+	}
+}
+
+func TestStart_noTracer(t *testing.T) {
+	ctx, s := Start(context.Background(), "config discovery")
+	if s != nil || ctx != context.Background() {
+		t.Fatalf("Start() = %v, %v, want no span", ctx, s)
+	}
+	s.SetAttr("cache", "hit")
+	s.End()
+	if Record(ctx, "connection", time.Now(), time.Now()) != nil {
+		t.Error("Record() recorded a span without a Tracer")
+	}
+}
@@ -1,80 +1,62 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"runtime/debug"
+	"syscall"
 
-	"github.com/yhiraki/remote/internal/command"
-	"github.com/yhiraki/remote/internal/config"
-	"github.com/yhiraki/remote/internal/host"
+	"github.com/yhiraki/remote/internal/logging"
+	"github.com/yhiraki/remote/internal/trace"
+	"github.com/yhiraki/remote/pkg/remote"
 )
 
-var (
-	home string
-	cwd  string
-)
-
-func init() {
-	var err error
-
-	home, err = os.UserHomeDir()
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	cwd, err = os.Getwd()
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-type stringSlice []string
-
-func (i *stringSlice) String() string {
-	return fmt.Sprintf("%v", *i)
-}
-
-func (i *stringSlice) Set(value string) error {
-	*i = append(*i, value)
-	return nil
-}
-
 func _main() error {
-	cfg, err := config.New()
-	if err != nil {
+	logOpts := logging.DefaultOptions
+	if err := logging.ParseEnv(os.Getenv(logging.EnvVar), &logOpts); err != nil {
 		return err
 	}
-
-	configName := ".remoterc.json"
-	if err := cfg.Load(configName); err != nil {
-		log.Printf("%s could not parsed.", configName)
-		return err
+	// keep the logs of config discovery until the flags say where they go
+	startupLog := &logging.Buffer{}
+	slog.SetDefault(slog.New(startupLog.Handler()))
+
+	// the phases are timed from the start, and reported if --trace is given
+	tr := trace.New()
+	traceCtx := trace.NewContext(context.Background(), tr)
+	_, span := trace.Start(traceCtx, "config discovery")
+	cfg, loadErr := remote.LoadConfig(remote.ConfigFileName)
+	if loadErr == nil {
+		span.SetAttr("file", cfg.Source)
 	}
-
-	// create directories
-	for _, d := range []string{cfg.CacheDir, cfg.ConfigDir} {
-		if _, err := os.Stat(d); err != nil {
-			if err = os.MkdirAll(d, 0o705); err != nil {
-				return err
-			}
+	span.End()
+
+	// command line parsing, logging as REMOTE_LOG says if it fails
+	inv, err := remote.Parse(os.Args[1:], cfg)
+	if err == nil {
+		var opts logging.Options
+		if opts, err = inv.Options.LogOptions(os.Getenv(logging.EnvVar)); err == nil {
+			logOpts = opts
 		}
 	}
+	closeLog, setupErr := logging.Setup(logOpts, os.Stderr)
+	if setupErr != nil {
+		return setupErr
+	}
+	defer closeLog()
+	startupLog.Flush(slog.Default().Handler())
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-	// command line parsing
-	var envVars stringSlice
-	flag.Var(&envVars, "e", "set environment variable (e.g. -e KEY=VALUE)")
-	flag.Var(&envVars, "env", "set environment variable (e.g. --env KEY=VALUE)")
-	isDryRun := flag.Bool("dry-run", false, "dry run")
-	isVerbose := flag.Bool("verbose", false, "enable verbose logging")
-	showVersion := flag.Bool("version", false, "print version information")
-	isBackground := flag.Bool("background", false, "run tunnel in background")
-	flag.Parse()
-
-	if *showVersion {
+	if inv.Options.ShowVersion {
 		if info, ok := debug.ReadBuildInfo(); ok {
 			fmt.Println(info.Main.Version)
 		} else {
@@ -83,26 +65,60 @@ func _main() error {
 		return nil
 	}
 
-	// get hostname
-	h := cfg.Hostname
-	if cfg.HostnameCommand != "" {
-		h, err = host.Get(
-			cfg.HostnameCommand,
-			filepath.Join(cfg.CacheDir, "hostname"),
-			cfg.CacheExpireMinutes,
-			*isVerbose)
-		if err != nil {
+	ctx := context.Background()
+	if inv.Options.Tracing() {
+		ctx = traceCtx
+		defer writeTrace(tr, inv.Options.TraceFile)
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	client := &remote.Client{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	if loadErr != nil {
+		if inv.Spec.NoConfig {
+			_, err := client.Run(ctx, inv)
+			return err
+		}
+		slog.Error("could not load the config file", "file", remote.ConfigFileName, "err", loadErr)
+		return loadErr
+	}
+
+	if inv.Options.Host != "" {
+		if err := cfg.UseHost(inv.Options.Host); err != nil {
 			return err
 		}
 	}
 
 	// get relative current path
-	cwdRel, err := filepath.Rel(home, cwd)
+	cwd, err := os.Getwd()
 	if err != nil {
 		return err
 	}
+	client.Config = cfg
+	if client.Dir, err = remote.RemoteDir(cwd); err != nil {
+		return err
+	}
+
+	// the host is resolved by the commands needing it
+	_, err = client.Run(ctx, inv)
+	return err
+}
 
-	return command.Run(cfg, h, flag.Args(), envVars, *isDryRun, *isBackground, *isVerbose, cwdRel)
+// writeTrace prints the timing breakdown of tr to stderr and writes its
+// spans to file, if not empty, as Chrome trace events.
+func writeTrace(tr *trace.Tracer, file string) {
+	tr.Report(os.Stderr)
+	if file == "" {
+		return
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		slog.Warn("could not write the trace", "file", file, "err", err)
+		return
+	}
+	defer f.Close()
+	if err := tr.WriteChrome(f); err != nil {
+		slog.Warn("could not write the trace", "file", file, "err", err)
+	}
 }
 
 func main() {
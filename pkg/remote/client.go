@@ -0,0 +1,245 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/yhiraki/remote/internal/command"
+)
+
+// Client runs commands and transfers against one remote host.
+type Client struct {
+	// Config may be nil for commands marked NoConfig, run with Run.
+	Config *Config
+	// Host is the remote host, resolved from Config on first use if empty.
+	Host string
+	// Dir is the remote working directory, relative to the remote home directory.
+	Dir string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// DryRun records the commands in the Result without running them.
+	DryRun bool
+	// Verbose lists every transferred file instead of reporting progress and a summary.
+	Verbose bool
+}
+
+// NewClient resolves the host of cfg and returns a Client working in the
+// remote directory corresponding to the current directory.
+func NewClient(ctx context.Context, cfg *Config) (*Client, error) {
+	h, err := ResolveHost(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := RemoteDir(cwd)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Config: cfg,
+		Host:   h,
+		Dir:    dir,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}, nil
+}
+
+// Result describes a finished operation.
+type Result struct {
+	// Commands are the local processes run, each as its argument list.
+	Commands [][]string
+	// ExitCode is the exit code of the last process, or -1 if it did not exit normally.
+	ExitCode int
+	Duration time.Duration
+}
+
+// ExecOptions configures Exec.
+type ExecOptions struct {
+	// Env holds KEY=VALUE pairs set for the remote command. A KEY alone
+	// forwards the local value. They are sent as EnvTransport of the config
+	// says, before Stdin by default.
+	Env []string
+	// Raw joins the arguments into a shell snippet instead of quoting each one.
+	Raw bool
+	// TTY requests a pseudo-terminal on the remote host.
+	TTY bool
+}
+
+// SyncOptions configures Push and Pull.
+type SyncOptions struct {
+	// Exclude lists patterns excluded in addition to the configured ExcludeFiles.
+	Exclude []string
+	// Mirror makes Push delete remote files that do not exist locally, after
+	// confirmation on Stdin unless Yes is set.
+	Mirror bool
+	Yes    bool
+	// Strategy decides what Pull does with existing local files.
+	Strategy PullStrategy
+	// RsyncOptions are passed to rsync after those of the config.
+	RsyncOptions []string
+	// BwLimit limits the bandwidth like rsync --bwlimit, overriding the config.
+	BwLimit string
+	// NoWait fails instead of waiting when another transfer of the project runs.
+	NoWait bool
+}
+
+// PullStrategy decides what Pull does with local files that already exist.
+type PullStrategy = command.PullStrategy
+
+const (
+	PullIgnoreExisting = command.PullIgnoreExisting
+	PullUpdate         = command.PullUpdate
+	PullOverwrite      = command.PullOverwrite
+	PullBackup         = command.PullBackup
+)
+
+// TunnelOptions configures Tunnel.
+type TunnelOptions struct {
+	// Background lets ssh fork once the ports are forwarded.
+	Background bool
+}
+
+// Exec runs args in Dir on the remote host. Each argument reaches the remote
+// command unchanged unless opts.Raw is set.
+func (c *Client) Exec(ctx context.Context, args []string, opts *ExecOptions) (*Result, error) {
+	if opts == nil {
+		opts = &ExecOptions{}
+	}
+	tty := command.TTYDisable
+	if opts.TTY {
+		tty = command.TTYForce
+	}
+	return c.run(ctx, &command.SSHCommand{EnvVars: opts.Env, IsRaw: opts.Raw, TTY: tty}, args, nil)
+}
+
+// Push transfers local paths to the same relative paths under Dir on the remote host.
+// Several paths, or glob patterns, are transferred at once keeping their paths
+// relative to the current directory.
+func (c *Client) Push(ctx context.Context, paths []string, opts *SyncOptions) (*Result, error) {
+	return c.sync(ctx, "push", paths, opts)
+}
+
+// Pull transfers paths under Dir on the remote host to the same local paths.
+// Glob patterns are expanded on the remote host.
+func (c *Client) Pull(ctx context.Context, paths []string, opts *SyncOptions) (*Result, error) {
+	return c.sync(ctx, "pull", paths, opts)
+}
+
+func (c *Client) sync(ctx context.Context, direction string, paths []string, opts *SyncOptions) (*Result, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("no path to transfer")
+	}
+	cfg := c.Config
+	if opts != nil && len(opts.Exclude) > 0 {
+		copied := *c.Config
+		copied.ExcludeFiles = append(append([]string{}, cfg.ExcludeFiles...), opts.Exclude...)
+		cfg = &copied
+	}
+	cmd := &command.RsyncCommand{Direction: direction}
+	if opts != nil {
+		cmd.Yes = opts.Yes
+		cmd.Options = opts.RsyncOptions
+		cmd.Transfer = command.TransferOptions{BwLimit: opts.BwLimit, NoWait: opts.NoWait}
+		if direction == "push" {
+			cmd.Mirror = opts.Mirror
+		} else {
+			cmd.Strategy = opts.Strategy
+		}
+	}
+	return c.run(ctx, cmd, paths, cfg)
+}
+
+// Tunnel forwards the local ports to the same ports on the remote host until
+// ctx is done, or returns once they are forwarded with opts.Background.
+// Ports may also name tunnels of the config.
+func (c *Client) Tunnel(ctx context.Context, ports []string, opts *TunnelOptions) (*Result, error) {
+	if opts == nil {
+		opts = &TunnelOptions{}
+	}
+	return c.run(ctx, &command.TunnelCommand{IsBackground: opts.Background}, ports, nil)
+}
+
+// Invocation is a command line of the remote tool, parsed by Parse.
+type Invocation = command.Invocation
+
+// Parse parses the arguments of a remote command line following the
+// program name, looking up aliases, tasks and plugins in cfg, which may be
+// nil. When help was requested, the usage is printed and flag.ErrHelp is
+// returned.
+func Parse(args []string, cfg *Config) (*Invocation, error) {
+	return command.Parse(args, cfg)
+}
+
+// Run runs a parsed command line as the remote tool does, with the streams
+// of c. Its global flags select dry-run and verbose mode in addition to
+// those of c.
+func (c *Client) Run(ctx context.Context, inv *Invocation) (*Result, error) {
+	return c.execute(ctx, nil, func(cctx *command.Context) error {
+		return inv.Execute(cctx)
+	})
+}
+
+// run executes cmd with args, using cfg instead of c.Config if not nil.
+func (c *Client) run(ctx context.Context, cmd command.Command, args []string, cfg *Config) (*Result, error) {
+	return c.execute(ctx, cfg, func(cctx *command.Context) error {
+		cctx.Args = args
+		return cmd.Execute(cctx)
+	})
+}
+
+// execute calls fn with a command context for c, using cfg instead of
+// c.Config if not nil, and reports the processes it ran.
+func (c *Client) execute(ctx context.Context, cfg *Config, fn func(*command.Context) error) (*Result, error) {
+	if cfg == nil {
+		cfg = c.Config
+	}
+	var resolveHost func() (string, error)
+	if cfg != nil {
+		resolveHost = func() (string, error) { return c.host(ctx) }
+	}
+	cctx := command.NewContext(ctx, cfg, resolveHost, c.Dir)
+	cctx.Stdin = c.Stdin
+	cctx.Stdout = c.Stdout
+	cctx.Stderr = c.Stderr
+	cctx.IsVerbose = c.Verbose
+	if c.DryRun {
+		cctx.DryRun = command.DryRunText
+	}
+
+	start := time.Now()
+	err := fn(cctx)
+	res := &Result{Duration: time.Since(start)}
+	for _, step := range cctx.Steps() {
+		res.Commands = append(res.Commands, append([]string{step.Command}, step.Args...))
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
+	} else if err != nil && len(res.Commands) > 0 {
+		res.ExitCode = -1
+	}
+	return res, err
+}
+
+// host returns Host, resolving it from Config if empty.
+func (c *Client) host(ctx context.Context) (string, error) {
+	if c.Host == "" {
+		h, err := ResolveHost(ctx, c.Config)
+		if err != nil {
+			return "", err
+		}
+		c.Host = h
+	}
+	return c.Host, nil
+}
@@ -0,0 +1,148 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeSSH puts an ssh executable running script on PATH.
+func fakeSSH(t *testing.T, script string) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "ssh"), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestClient_Exec(t *testing.T) {
+	fakeSSH(t, `echo "$@"; cat; exit 3`)
+
+	var stdout bytes.Buffer
+	c := &Client{
+		Config: &Config{},
+		Host:   "example.com",
+		Dir:    "src",
+		Stdin:  strings.NewReader("input\n"),
+		Stdout: &stdout,
+	}
+	res, err := c.Exec(context.Background(), []string{"grep", "foo bar"}, &ExecOptions{Env: []string{"A=1"}})
+	if err == nil {
+		t.Error("Client.Exec() expected error for non-zero exit, got nil")
+	}
+	if res.ExitCode != 3 {
+		t.Errorf("Result.ExitCode = %v, want 3", res.ExitCode)
+	}
+	want := `example.com -T cd src; IFS= read -r REMOTE_ENV && eval "export $REMOTE_ENV" && unset REMOTE_ENV || exit 1; exec grep 'foo bar'` + "\n'A=1'\ninput\n"
+	if stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestClient_DryRun(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(tmpFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{
+		Config: &Config{ExcludeFiles: []string{".git"}, Tunnels: map[string]Ports{"web": {"8080"}}},
+		Host:   "example.com",
+		Dir:    "src",
+		DryRun: true,
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func() (*Result, error)
+		want [][]string
+	}{
+		{
+			name: "exec raw",
+			run: func() (*Result, error) {
+				return c.Exec(ctx, []string{"ls | wc -l"}, &ExecOptions{Raw: true, TTY: true})
+			},
+			want: [][]string{{"ssh", "example.com", "-t", "cd src; exec sh -c 'ls | wc -l'"}},
+		},
+		{
+			name: "push with extra excludes",
+			run: func() (*Result, error) {
+				return c.Push(ctx, []string{tmpFile}, &SyncOptions{Exclude: []string{"*.log"}})
+			},
+			want: [][]string{{"rsync", "--exclude", ".git", "--exclude", "*.log", "-a", "--itemize-changes", "--info=progress2", "--stats", tmpFile, "example.com:" + tmpFile}},
+		},
+		{
+			name: "pull",
+			run: func() (*Result, error) {
+				return c.Pull(ctx, []string{"app.log"}, nil)
+			},
+			want: [][]string{{"rsync", "--exclude", ".git", "-a", "--itemize-changes", "--info=progress2", "--stats", "--ignore-existing", "example.com:src/app.log", "app.log"}},
+		},
+		{
+			name: "tunnel",
+			run: func() (*Result, error) {
+				return c.Tunnel(ctx, []string{"web"}, &TunnelOptions{Background: true})
+			},
+			want: [][]string{{"ssh", "-N", "-f", "-L", "8080:localhost:8080", "example.com"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.run()
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !reflect.DeepEqual(res.Commands, tt.want) {
+				t.Errorf("Result.Commands = %q, want %q", res.Commands, tt.want)
+			}
+		})
+	}
+
+	if len(c.Config.ExcludeFiles) != 1 {
+		t.Errorf("Push modified Config.ExcludeFiles: %v", c.Config.ExcludeFiles)
+	}
+}
+
+func TestClient_Run(t *testing.T) {
+	cfg := &Config{Hostname: "example.com"}
+	inv, err := Parse([]string{"--dry-run=json", "sh", "-T", "make"}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	c := &Client{Config: cfg, Dir: "src", Stdout: &stdout}
+	res, err := c.Run(context.Background(), inv)
+	if err != nil {
+		t.Fatalf("Client.Run() error = %v", err)
+	}
+	if want := [][]string{{"ssh", "example.com", "-T", "cd src; exec make"}}; !reflect.DeepEqual(res.Commands, want) {
+		t.Errorf("Result.Commands = %q, want %q", res.Commands, want)
+	}
+	// the host is resolved from the config, and the plan printed as asked
+	if c.Host != "example.com" {
+		t.Errorf("Client.Host = %q, want example.com", c.Host)
+	}
+	if !strings.Contains(stdout.String(), `"host": "example.com"`) {
+		t.Errorf("stdout = %q, want a JSON plan", stdout.String())
+	}
+}
+
+func TestRemoteDir(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := RemoteDir(filepath.Join(home, "src", "project"))
+	if err != nil {
+		t.Fatalf("RemoteDir() error = %v", err)
+	}
+	if got != filepath.Join("src", "project") {
+		t.Errorf("RemoteDir() = %v, want src/project", got)
+	}
+}
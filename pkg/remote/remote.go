@@ -0,0 +1,81 @@
+// Package remote loads remote configuration, resolves the remote host and
+// runs commands and transfers against it. It is the library behind the
+// remote command line tool.
+package remote
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/yhiraki/remote/internal/config"
+	"github.com/yhiraki/remote/internal/host"
+)
+
+// ConfigFileName is the name of the config file looked up by LoadConfig.
+const ConfigFileName = ".remoterc.json"
+
+// Config is the content of a config file.
+type Config = config.Config
+
+// Host is a named host profile of a Config.
+type Host = config.Host
+
+// Ports lists the ports of a named tunnel.
+type Ports = config.Ports
+
+// Task is a named sequence of command lines of a Config.
+type Task = config.Task
+
+// CommandLine is a command line of an alias or a task.
+type CommandLine = config.CommandLine
+
+// LoadConfig loads the config file named fileName from the current directory
+// or its closest parent containing one, falling back to the user config
+// directory, and creates the config and cache directories.
+func LoadConfig(fileName string) (*Config, error) {
+	cfg, err := config.New()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Load(fileName); err != nil {
+		return nil, err
+	}
+
+	// create directories
+	for _, d := range []string{cfg.CacheDir, cfg.ConfigDir} {
+		if _, err := os.Stat(d); err != nil {
+			if err = os.MkdirAll(d, 0o705); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// ResolveHost returns the remote host of cfg. When HostnameCommand is set,
+// its output is cached in CacheDir for CacheExpireMinutes.
+func ResolveHost(ctx context.Context, cfg *Config) (string, error) {
+	if cfg.HostnameCommand == "" {
+		return cfg.Hostname, nil
+	}
+	return host.Get(
+		ctx,
+		cfg.HostnameCommand,
+		cfg.HostnameCacheFile(),
+		cfg.CacheExpireMinutes)
+}
+
+// RemoteDir returns the directory on the remote host corresponding to the
+// local directory dir: its path relative to the home directory.
+func RemoteDir(dir string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(home, abs)
+}